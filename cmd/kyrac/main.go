@@ -5,15 +5,15 @@ import (
     "fmt"
     "os"
 
+    "kyra"
     "kyra/internal/bytecode"
     "kyra/internal/kar"
-    "kyra/internal/lexer"
-    "kyra/internal/parser"
 )
 
 func main() {
     modeModule := flag.String("m", "", "Compile a single Kyra file to .kbc")
     modeKar := flag.String("kar", "", "Build a .kar executable archive")
+    modeDisasm := flag.String("disasm", "", "Disassemble a .kbc file")
     flag.Parse()
 
     if *modeModule != "" {
@@ -26,9 +26,15 @@ func main() {
         return
     }
 
+    if *modeDisasm != "" {
+        disassemble(*modeDisasm)
+        return
+    }
+
     fmt.Println("Usage:")
     fmt.Println("  kyrac -m <file.kyra>")
     fmt.Println("  kyrac -kar <project-folder>")
+    fmt.Println("  kyrac -disasm <file.kbc>")
 }
 
 func compileModule(path string) {
@@ -37,23 +43,37 @@ func compileModule(path string) {
         panic(err)
     }
 
-    // Lexing
-    lx := lexer.New(string(src))
-    tokens := lx.Lex()
-
-    // Parsing
-    p := parser.New(tokens)
-    ast := p.Parse()
-
-    // Bytecode emission
-    bc := bytecode.Emit(ast)
+    prog, err := kyra.Compile(string(src))
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
 
     out := path[:len(path)-5] + ".kbc"
-    os.WriteFile(out, bc, 0644)
+    os.WriteFile(out, prog.Bytecode(), 0644)
 
     fmt.Println("Compiled:", out)
 }
 
+func disassemble(path string) {
+    b, err := os.ReadFile(path)
+    if err != nil {
+        panic(err)
+    }
+
+    // Emit still targets the legacy KBC v2 format kvm.loadModule reads;
+    // -disasm speaks the new v3 format this change introduces, so it
+    // only inspects .kbc files written via bytecode.Marshal until Emit is
+    // reworked onto Program (tracked separately).
+    prog, err := bytecode.Unmarshal(b)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "disasm:", err)
+        os.Exit(1)
+    }
+
+    fmt.Print(bytecode.Disassemble(prog))
+}
+
 func buildKar(project string) {
     err := kar.Build(project)
     if err != nil {
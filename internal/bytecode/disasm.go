@@ -0,0 +1,135 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// mnemonics names every opcode for disassembly; kept separate from the
+// OP_ constants so adding a mnemonic can't be forgotten silently (a
+// missing entry renders as its hex byte, "0x..", instead).
+var mnemonics = map[byte]string{
+	OP_CONST:    "CONST",
+	OP_ADD:      "ADD",
+	OP_SUB:      "SUB",
+	OP_MUL:      "MUL",
+	OP_DIV:      "DIV",
+	OP_MOD:      "MOD",
+	OP_EQ:       "EQ",
+	OP_NEQ:      "NEQ",
+	OP_LT:       "LT",
+	OP_GT:       "GT",
+	OP_LE:       "LE",
+	OP_GE:       "GE",
+	OP_AND:      "AND",
+	OP_OR:       "OR",
+	OP_NOT:      "NOT",
+	OP_LOAD:     "LOAD",
+	OP_STORE:    "STORE",
+	OP_CALL:     "CALL",
+	OP_RET:      "RET",
+	OP_JMP:      "JMP",
+	OP_JMPF:     "JMPF",
+	OP_POP:      "POP",
+	OP_EXIT:     "EXIT",
+	OP_HOSTCALL:  "HOSTCALL",
+	OP_SPAWN:     "SPAWN",
+	OP_CHAN_MAKE: "CHAN_MAKE",
+	OP_CHAN_SEND: "CHAN_SEND",
+	OP_CHAN_RECV: "CHAN_RECV",
+	OP_YIELD:     "YIELD",
+	OP_CONST_I64:  "CONST_I64",
+	OP_CONST_F64:  "CONST_F64",
+	OP_CONST_STR:  "CONST_STR",
+	OP_LOAD_NAME:  "LOAD_NAME",
+	OP_STORE_NAME: "STORE_NAME",
+	OP_JMPT:       "JMPT",
+	OP_STORE_ZERO: "STORE_ZERO",
+}
+
+// opsWithIntOperand lists the opcodes whose single operand is a 4-byte
+// little-endian int immediately following them in the code stream, as
+// emitted by Chunk.emitInt.
+var opsWithIntOperand = map[byte]bool{
+	OP_CONST: true, OP_LOAD: true, OP_STORE: true,
+	OP_CALL: true, OP_JMP: true, OP_JMPF: true,
+	OP_SPAWN: true, OP_CHAN_MAKE: true,
+	OP_CONST_I64: true, OP_CONST_F64: true, OP_CONST_STR: true,
+	OP_LOAD_NAME: true, OP_STORE_NAME: true,
+	OP_JMPT: true, OP_STORE_ZERO: true,
+}
+
+// Disassemble renders every instruction in prog.Code with its mnemonic,
+// operand value, the resolved constant (for OP_CONST/OP_LOAD/OP_STORE),
+// and the originating source line looked up from prog.Lines.
+func Disassemble(prog *Program) string {
+	var b strings.Builder
+
+	for _, fn := range prog.Functions {
+		fmt.Fprintf(&b, "func %s:\n", fn.Name)
+		disassembleRange(&b, prog, fn.Offset, fn.Offset+fn.Length)
+	}
+
+	if len(prog.Functions) > 0 {
+		b.WriteString("main:\n")
+	}
+	mainStart := 0
+	if len(prog.Functions) > 0 {
+		last := prog.Functions[len(prog.Functions)-1]
+		mainStart = last.Offset + last.Length
+	}
+	disassembleRange(&b, prog, mainStart, len(prog.Code))
+
+	return b.String()
+}
+
+func disassembleRange(b *strings.Builder, prog *Program, start, end int) {
+	code := prog.Code
+	pc := start
+	for pc < end {
+		op := code[pc]
+		name, ok := mnemonics[op]
+		if !ok {
+			name = fmt.Sprintf("0x%02X", op)
+		}
+
+		line := lineForPC(prog.Lines, pc)
+		fmt.Fprintf(b, "  %04d  line %-4d  %-9s", pc, line, name)
+		pc++
+
+		if opsWithIntOperand[op] {
+			operand := int(binary.LittleEndian.Uint32(code[pc:]))
+			pc += 4
+			fmt.Fprintf(b, " %d", operand)
+
+			if (op == OP_CONST || op == OP_CONST_I64 || op == OP_LOAD || op == OP_STORE) && operand >= 0 && operand < len(prog.Constants) {
+				fmt.Fprintf(b, "  ; %#v", prog.Constants[operand])
+			}
+		}
+
+		if op == OP_HOSTCALL {
+			nameIdx := int(binary.LittleEndian.Uint32(code[pc:]))
+			pc += 4
+			argCount := int(binary.LittleEndian.Uint32(code[pc:]))
+			pc += 4
+			fmt.Fprintf(b, " %d %d", nameIdx, argCount)
+			if nameIdx >= 0 && nameIdx < len(prog.Constants) {
+				fmt.Fprintf(b, "  ; %#v argc=%d", prog.Constants[nameIdx], argCount)
+			}
+		}
+
+		b.WriteByte('\n')
+	}
+}
+
+// lineForPC finds the source line active at pc: the last LineEntry whose
+// PC is <= pc. lines must be sorted by PC ascending.
+func lineForPC(lines []LineEntry, pc int) int {
+	i := sort.Search(len(lines), func(i int) bool { return lines[i].PC > pc })
+	if i == 0 {
+		return 0
+	}
+	return lines[i-1].Line
+}
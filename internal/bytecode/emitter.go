@@ -40,23 +40,88 @@ const (
 
 	OP_POP  = 0x16
 	OP_EXIT = 0x17
+
+	// OP_HOSTCALL dispatches to a Go callable bound via kvm.VM.Bind for
+	// embedder FFI. Operands: the name constant index, then the arg
+	// count; arguments are popped off the stack the same way OP_CALL's
+	// callee arguments are.
+	OP_HOSTCALL = 0x18
+
+	// Green-thread concurrency. OP_SPAWN pops a function-id value and
+	// reads an arg-count operand (mirroring OP_CALL), creating a new
+	// kvm.Thread and pushing its thread-handle id. OP_CHAN_MAKE reads a
+	// capacity operand and pushes a new bounded channel value.
+	// OP_CHAN_SEND pops a channel then a value; OP_CHAN_RECV pops a
+	// channel and pushes the received value; both block the current
+	// thread rather than the opcode completing synchronously if the
+	// other side isn't ready. OP_YIELD cooperatively requeues the
+	// current thread behind any others.
+	OP_SPAWN     = 0x19
+	OP_CHAN_MAKE = 0x1A
+	OP_CHAN_SEND = 0x1B
+	OP_CHAN_RECV = 0x1C
+	OP_YIELD     = 0x1D
+
+	// OP_CONST_I64, OP_CONST_F64, and OP_CONST_STR replace the untyped
+	// OP_CONST: each loads from its own typed, deduplicated pool
+	// (Chunk.Ints/Floats/Strings) rather than a single []interface{}
+	// pool where e.g. a repeated 1.0 or "i" got a fresh slot every time
+	// it was emitted. OP_LOAD_NAME/OP_STORE_NAME likewise resolve a
+	// variable by an index into Chunk.Names rather than re-adding the
+	// name string as an ordinary constant on every reference.
+	OP_CONST_I64  = 0x1E
+	OP_CONST_F64  = 0x1F
+	OP_CONST_STR  = 0x20
+	OP_LOAD_NAME  = 0x21
+	OP_STORE_NAME = 0x22
+
+	// OP_JMPT is OP_JMPF's mirror: it pops a condition and jumps only
+	// when it's truthy. Added for short-circuit &&/|| codegen (see
+	// emitLogicalAnd/emitLogicalOr), which needs to jump past the RHS on
+	// a truthy LHS (||) the same way OP_JMPF already lets it jump past
+	// the RHS on a falsy one (&&).
+	OP_JMPT = 0x23
+
+	// OP_STORE_ZERO is a peephole-optimized OP_STORE_NAME: the optimize
+	// package collapses "push the int 0; store name N" into this single
+	// instruction, whose only operand is N's name index.
+	OP_STORE_ZERO = 0x24
 )
 
 // ---------------------------
 // Chunk structure
 // ---------------------------
 
+// Chunk holds one compiled unit's code alongside four typed constant
+// pools. Each pool is deduplicated (see AddInt/AddFloat/AddString/
+// AddName): emitting the same int, float, string, or name more than
+// once reuses the existing slot instead of growing the pool, which
+// matters most for names and small literals (0, 1, a loop variable)
+// that get referenced on every iteration. The intended KBC layout is
+// four length-prefixed sub-tables in this order -- Ints, Floats,
+// Strings, Names -- each a count followed by that many fixed- or
+// length-prefixed entries, ahead of the code section.
 type Chunk struct {
-	Code      []byte
-	Constants []interface{}
-	Names     map[string]int
+	Code []byte
+
+	Ints    []int64
+	Floats  []float64
+	Strings []string
+	Names   []string
+
+	intIndex    map[int64]int
+	floatIndex  map[float64]int
+	stringIndex map[string]int
+	nameIndex   map[string]int
 }
 
 func NewChunk() *Chunk {
 	return &Chunk{
-		Code:      []byte{},
-		Constants: []interface{}{},
-		Names:     map[string]int{},
+		Code:        []byte{},
+		intIndex:    map[int64]int{},
+		floatIndex:  map[float64]int{},
+		stringIndex: map[string]int{},
+		nameIndex:   map[string]int{},
 	}
 }
 
@@ -70,16 +135,64 @@ func (c *Chunk) emitInt(v int) {
 	c.Code = append(c.Code, buf...)
 }
 
-func (c *Chunk) addConst(v interface{}) int {
-	c.Constants = append(c.Constants, v)
-	return len(c.Constants) - 1
+func (c *Chunk) AddInt(v int64) int {
+	if idx, ok := c.intIndex[v]; ok {
+		return idx
+	}
+	idx := len(c.Ints)
+	c.Ints = append(c.Ints, v)
+	c.intIndex[v] = idx
+	return idx
+}
+
+func (c *Chunk) AddFloat(v float64) int {
+	if idx, ok := c.floatIndex[v]; ok {
+		return idx
+	}
+	idx := len(c.Floats)
+	c.Floats = append(c.Floats, v)
+	c.floatIndex[v] = idx
+	return idx
+}
+
+func (c *Chunk) AddString(v string) int {
+	if idx, ok := c.stringIndex[v]; ok {
+		return idx
+	}
+	idx := len(c.Strings)
+	c.Strings = append(c.Strings, v)
+	c.stringIndex[v] = idx
+	return idx
+}
+
+func (c *Chunk) AddName(v string) int {
+	if idx, ok := c.nameIndex[v]; ok {
+		return idx
+	}
+	idx := len(c.Names)
+	c.Names = append(c.Names, v)
+	c.nameIndex[v] = idx
+	return idx
 }
 
 // ---------------------------
 // Emitter entry
 // ---------------------------
 
+// Emit is the unoptimized convenience entry point: it builds ast's main
+// chunk and encodes it straight to KBC v2 bytes. Callers that also want
+// the internal/optimize peephole pass (every caller in this module does)
+// should use EmitChunk and Encode instead, running optimize.Pass on the
+// chunk in between -- optimize necessarily imports this package for
+// *Chunk and the OP_ constants, so Emit itself can't call it without
+// introducing an import cycle.
 func Emit(ast *parser.AST) []byte {
+	return Encode(EmitChunk(ast))
+}
+
+// EmitChunk builds ast's main chunk without encoding it, so a caller can
+// run a pass (e.g. optimize.Pass) over the raw Chunk first.
+func EmitChunk(ast *parser.AST) *Chunk {
 	// Funktions-Tabelle für dieses Modul zurücksetzen
 	resetFunctions()
 
@@ -92,8 +205,13 @@ func Emit(ast *parser.AST) []byte {
 	// Implizites return aus main
 	mainChunk.emit(OP_RET)
 
+	return mainChunk
+}
+
+// Encode serializes c (and the module's function chunks) to KBC v2 bytes.
+func Encode(c *Chunk) []byte {
 	// Mit Funktionen + Main-Chunk zu KBC v2 encodieren
-	return encodeModuleWithFunctions(mainChunk)
+	return encodeModuleWithFunctions(c)
 }
 
 // ---------------------------
@@ -109,8 +227,8 @@ func emitStmt(c *Chunk, stmt parser.Stmt) {
 
 	case *parser.LetStmt:
 		emitExpr(c, s.Expr)
-		slot := c.addConst(s.Name)
-		c.emit(OP_STORE)
+		slot := c.AddName(s.Name)
+		c.emit(OP_STORE_NAME)
 		c.emitInt(slot)
 
 	case *parser.ReturnStmt:
@@ -124,29 +242,55 @@ func emitStmt(c *Chunk, stmt parser.Stmt) {
 		// no-op
 
 	case *parser.IfStmt:
-		emitExpr(c, s.Cond)
-		c.emit(OP_JMPF)
-		jumpPos := len(c.Code)
-		c.emitInt(0)
-
-		for _, st := range s.Then {
-			emitStmt(c, st)
-		}
-
-		if len(s.Else) > 0 {
-			c.emit(OP_JMP)
-			elseJump := len(c.Code)
+		switch {
+		case len(s.Then) == 0 && len(s.Else) == 0:
+			// Neither branch has a body: Cond may still have side
+			// effects (a call), so it's still evaluated, but there's
+			// nothing to jump over -- skip the JMPF/patch pair entirely.
+			emitExpr(c, s.Cond)
+			c.emit(OP_POP)
+
+		case len(s.Then) == 0:
+			// Empty Then with a non-empty Else: invert Cond and emit
+			// Else as the "then" branch, rather than a JMPF over an
+			// empty Then followed by a JMP into Else.
+			emitExpr(c, s.Cond)
+			c.emit(OP_NOT)
+			c.emit(OP_JMPF)
+			jumpPos := len(c.Code)
 			c.emitInt(0)
 
-			patchJump(c, jumpPos)
-
 			for _, st := range s.Else {
 				emitStmt(c, st)
 			}
 
-			patchJump(c, elseJump)
-		} else {
 			patchJump(c, jumpPos)
+
+		default:
+			emitExpr(c, s.Cond)
+			c.emit(OP_JMPF)
+			jumpPos := len(c.Code)
+			c.emitInt(0)
+
+			for _, st := range s.Then {
+				emitStmt(c, st)
+			}
+
+			if len(s.Else) > 0 {
+				c.emit(OP_JMP)
+				elseJump := len(c.Code)
+				c.emitInt(0)
+
+				patchJump(c, jumpPos)
+
+				for _, st := range s.Else {
+					emitStmt(c, st)
+				}
+
+				patchJump(c, elseJump)
+			} else {
+				patchJump(c, jumpPos)
+			}
 		}
 
 	case *parser.WhileStmt:
@@ -169,22 +313,22 @@ func emitStmt(c *Chunk, stmt parser.Stmt) {
 	case *parser.ForStmt:
 		// for i 10:
 		emitExpr(c, s.Limit)
-		limitSlot := c.addConst(s.VarName + "_limit")
-		c.emit(OP_STORE)
+		limitSlot := c.AddName(s.VarName + "_limit")
+		c.emit(OP_STORE_NAME)
 		c.emitInt(limitSlot)
 
-		iSlot := c.addConst(s.VarName)
-		c.emit(OP_CONST)
-		c.emitInt(c.addConst(float64(0)))
-		c.emit(OP_STORE)
+		iSlot := c.AddName(s.VarName)
+		c.emit(OP_CONST_I64)
+		c.emitInt(c.AddInt(0))
+		c.emit(OP_STORE_NAME)
 		c.emitInt(iSlot)
 
 		loopStart := len(c.Code)
 
 		// if i >= limit: break
-		c.emit(OP_LOAD)
+		c.emit(OP_LOAD_NAME)
 		c.emitInt(iSlot)
-		c.emit(OP_LOAD)
+		c.emit(OP_LOAD_NAME)
 		c.emitInt(limitSlot)
 		c.emit(OP_GE)
 		c.emit(OP_JMPF)
@@ -196,12 +340,12 @@ func emitStmt(c *Chunk, stmt parser.Stmt) {
 		}
 
 		// i = i + 1
-		c.emit(OP_LOAD)
+		c.emit(OP_LOAD_NAME)
 		c.emitInt(iSlot)
-		c.emit(OP_CONST)
-		c.emitInt(c.addConst(float64(1)))
+		c.emit(OP_CONST_I64)
+		c.emitInt(c.AddInt(1))
 		c.emit(OP_ADD)
-		c.emit(OP_STORE)
+		c.emit(OP_STORE_NAME)
 		c.emitInt(iSlot)
 
 		c.emit(OP_JMP)
@@ -232,42 +376,47 @@ func emitExpr(c *Chunk, expr parser.Expr) {
 	switch e := expr.(type) {
 
 	case *parser.NumberExpr:
-		val := parseNumber(e.Value)
-		slot := c.addConst(val)
-		c.emit(OP_CONST)
-		c.emitInt(slot)
+		if e.IsInt {
+			slot := c.AddInt(e.IntValue)
+			c.emit(OP_CONST_I64)
+			c.emitInt(slot)
+		} else {
+			slot := c.AddFloat(e.FloatValue)
+			c.emit(OP_CONST_F64)
+			c.emitInt(slot)
+		}
 
 	case *parser.StringExpr:
-		slot := c.addConst(e.Value)
-		c.emit(OP_CONST)
+		slot := c.AddString(e.Value)
+		c.emit(OP_CONST_STR)
 		c.emitInt(slot)
 
 	case *parser.BoolExpr:
-		val := 0.0
+		val := int64(0)
 		if e.Value {
-			val = 1.0
+			val = 1
 		}
-		slot := c.addConst(val)
-		c.emit(OP_CONST)
+		slot := c.AddInt(val)
+		c.emit(OP_CONST_I64)
 		c.emitInt(slot)
 
 	case *parser.IdentExpr:
-		slot := c.addConst(e.Name)
-		c.emit(OP_LOAD)
+		slot := c.AddName(e.Name)
+		c.emit(OP_LOAD_NAME)
 		c.emitInt(slot)
 
 	case *parser.AssignExpr:
 		emitExpr(c, e.Expr)
-		slot := c.addConst(e.Name)
-		c.emit(OP_STORE)
+		slot := c.AddName(e.Name)
+		c.emit(OP_STORE_NAME)
 		c.emitInt(slot)
 
 	case *parser.UnaryExpr:
 		emitExpr(c, e.Expr)
 		switch e.Op {
 		case "-":
-			c.emit(OP_CONST)
-			c.emitInt(c.addConst(float64(-1)))
+			c.emit(OP_CONST_I64)
+			c.emitInt(c.AddInt(-1))
 			c.emit(OP_MUL)
 		case "!":
 			c.emit(OP_NOT)
@@ -276,14 +425,35 @@ func emitExpr(c *Chunk, expr parser.Expr) {
 		}
 
 	case *parser.BinaryExpr:
-		emitExpr(c, e.Left)
-		emitExpr(c, e.Right)
-		emitBinaryOp(c, e.Op)
+		switch e.Op {
+		case "&&":
+			emitLogicalAnd(c, e)
+		case "||":
+			emitLogicalOr(c, e)
+		default:
+			emitExpr(c, e.Left)
+			emitExpr(c, e.Right)
+			emitBinaryOp(c, e.Op)
+		}
 
 	case *parser.CallExpr:
+		callee, ok := e.Callee.(*parser.IdentExpr)
+		if !ok {
+			panic("call target must be a named function")
+		}
 		for _, arg := range e.Args {
 			emitExpr(c, arg)
 		}
+		// The callee's function id is pushed last, after every argument,
+		// since OP_CALL pops it off the top of the stack before handing
+		// the remaining argCount values to callFunction. It goes out as
+		// OP_CONST_F64, not OP_CONST_I64: the OP_CALL/OP_SPAWN handlers in
+		// internal/kvm both read it back via `t.pop().(float64)`, matching
+		// the thread-id float64 OP_SPAWN itself pushes for a spawned
+		// thread's handle.
+		id := resolveFunction(callee.Name)
+		c.emit(OP_CONST_F64)
+		c.emitInt(c.AddFloat(float64(id)))
 		c.emit(OP_CALL)
 		c.emitInt(len(e.Args))
 
@@ -298,6 +468,54 @@ func emitExpr(c *Chunk, expr parser.Expr) {
 	}
 }
 
+// emitLogicalAnd compiles "left && right" as genuine short-circuit
+// control flow rather than the eager OP_AND: if left is falsy, right is
+// never evaluated and the expression's value is 0; otherwise right is
+// evaluated and normalized to 0/1 (via the OP_NOT/OP_NOT double negation
+// also used by OP_NOT itself) so the result is boolean either way.
+func emitLogicalAnd(c *Chunk, e *parser.BinaryExpr) {
+	emitExpr(c, e.Left)
+	c.emit(OP_JMPF)
+	falsePos := len(c.Code)
+	c.emitInt(0)
+
+	emitExpr(c, e.Right)
+	c.emit(OP_NOT)
+	c.emit(OP_NOT)
+	c.emit(OP_JMP)
+	endPos := len(c.Code)
+	c.emitInt(0)
+
+	patchJump(c, falsePos)
+	c.emit(OP_CONST_I64)
+	c.emitInt(c.AddInt(0))
+
+	patchJump(c, endPos)
+}
+
+// emitLogicalOr mirrors emitLogicalAnd: if left is truthy, right is
+// never evaluated and the expression's value is 1; otherwise right is
+// evaluated and normalized to 0/1.
+func emitLogicalOr(c *Chunk, e *parser.BinaryExpr) {
+	emitExpr(c, e.Left)
+	c.emit(OP_JMPT)
+	truePos := len(c.Code)
+	c.emitInt(0)
+
+	emitExpr(c, e.Right)
+	c.emit(OP_NOT)
+	c.emit(OP_NOT)
+	c.emit(OP_JMP)
+	endPos := len(c.Code)
+	c.emitInt(0)
+
+	patchJump(c, truePos)
+	c.emit(OP_CONST_I64)
+	c.emitInt(c.AddInt(1))
+
+	patchJump(c, endPos)
+}
+
 func emitBinaryOp(c *Chunk, op string) {
 	switch op {
 	case "+":
@@ -340,8 +558,3 @@ func patchJump(c *Chunk, pos int) {
 	binary.LittleEndian.PutUint32(c.Code[pos:pos+4], uint32(target))
 }
 
-func parseNumber(s string) float64 {
-	var v float64
-	fmt.Sscanf(s, "%f", &v)
-	return v
-}
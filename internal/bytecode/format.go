@@ -0,0 +1,351 @@
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// KBC v3 replaces the v2 format's inline function chunks and fragile
+// offset math (see internal/kvm.loadModule) with a versioned header
+// followed by a table of contents: fixed-size (offset, length) pairs for
+// each section, so a reader can jump straight to e.g. the pcln table
+// without walking every byte in front of it.
+//
+// Layout:
+//
+//	"KBC3"              magic (4 bytes)
+//	toc                 tableOfContents, one entry per section below
+//	constants section   varint count, then Kind-tagged constants
+//	code section        raw instruction bytes
+//	functions section    varint count, then (name, codeOff, codeLen) per fn,
+//	                     the name written inline as a varint length + bytes
+//	lines section        varint count, then (pc, line) pairs (pcln table)
+//
+// There is no symbol-table or debug-string section: the table of
+// contents has exactly these four entries.
+const kbc3Magic = "KBC3"
+
+// ConstKind tags a Program constant's Go type in the constants section.
+type ConstKind byte
+
+const (
+	ConstBool ConstKind = iota
+	ConstNil
+	ConstInt
+	ConstFloat
+	ConstString
+	ConstFuncRef
+)
+
+// Program is the in-memory form of a parsed KBC v3 module: a flat
+// constant pool shared by all functions, a code section holding every
+// function's instructions back to back, and a function table of
+// (name, offset, length) slices into that code section.
+type Program struct {
+	Constants []interface{}
+	Code      []byte
+	Functions []FuncEntry
+
+	// Lines maps a program counter to the source line it was emitted
+	// from, sorted by PC; Disassemble does a binary search over it.
+	Lines []LineEntry
+}
+
+// FuncEntry describes one function's slice of the shared Code section.
+type FuncEntry struct {
+	Name   string
+	Offset int
+	Length int
+}
+
+// LineEntry is one row of the pcln (pc-to-line) table.
+type LineEntry struct {
+	PC   int
+	Line int
+}
+
+type sectionOffset struct {
+	Offset uint32
+	Length uint32
+}
+
+// Marshal encodes prog into the KBC v3 byte format.
+func Marshal(prog *Program) []byte {
+	constants := marshalConstants(prog.Constants)
+	functions := marshalFunctions(prog.Functions)
+	lines := marshalLines(prog.Lines)
+	code := prog.Code
+
+	// Layout: magic, 4 fixed TOC entries (8 bytes each), then sections in
+	// the same order the TOC lists them.
+	const tocEntries = 4
+	headerLen := len(kbc3Magic) + tocEntries*8
+
+	offsets := make([]sectionOffset, tocEntries)
+	cursor := uint32(headerLen)
+	sections := [][]byte{constants, code, functions, lines}
+	for i, s := range sections {
+		offsets[i] = sectionOffset{Offset: cursor, Length: uint32(len(s))}
+		cursor += uint32(len(s))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(kbc3Magic)
+	for _, off := range offsets {
+		writeUint32(&buf, off.Offset)
+		writeUint32(&buf, off.Length)
+	}
+	for _, s := range sections {
+		buf.Write(s)
+	}
+
+	return buf.Bytes()
+}
+
+// Unmarshal decodes a KBC v3 byte slice back into a Program. It returns
+// an error (rather than panicking, unlike the legacy v2 loader in
+// kvm.loadModule) if the magic is wrong or a section is malformed.
+func Unmarshal(b []byte) (*Program, error) {
+	if len(b) < len(kbc3Magic) || string(b[:len(kbc3Magic)]) != kbc3Magic {
+		return nil, fmt.Errorf("bytecode: bad KBC v3 magic")
+	}
+
+	const tocEntries = 4
+	pos := len(kbc3Magic)
+	offsets := make([]sectionOffset, tocEntries)
+	for i := range offsets {
+		if pos+8 > len(b) {
+			return nil, fmt.Errorf("bytecode: truncated table of contents")
+		}
+		offsets[i].Offset = binary.LittleEndian.Uint32(b[pos:])
+		offsets[i].Length = binary.LittleEndian.Uint32(b[pos+4:])
+		pos += 8
+	}
+
+	section := func(i int) ([]byte, error) {
+		off, length := offsets[i].Offset, offsets[i].Length
+		if int(off+length) > len(b) {
+			return nil, fmt.Errorf("bytecode: section %d out of range", i)
+		}
+		return b[off : off+length], nil
+	}
+
+	constantsBytes, err := section(0)
+	if err != nil {
+		return nil, err
+	}
+	codeBytes, err := section(1)
+	if err != nil {
+		return nil, err
+	}
+	functionsBytes, err := section(2)
+	if err != nil {
+		return nil, err
+	}
+	linesBytes, err := section(3)
+	if err != nil {
+		return nil, err
+	}
+
+	constants, err := unmarshalConstants(constantsBytes)
+	if err != nil {
+		return nil, err
+	}
+	functions, err := unmarshalFunctions(functionsBytes)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := unmarshalLines(linesBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{
+		Constants: constants,
+		Code:      append([]byte{}, codeBytes...),
+		Functions: functions,
+		Lines:     lines,
+	}, nil
+}
+
+func marshalConstants(consts []interface{}) []byte {
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(len(consts)))
+	for _, c := range consts {
+		switch v := c.(type) {
+		case nil:
+			buf.WriteByte(byte(ConstNil))
+		case bool:
+			buf.WriteByte(byte(ConstBool))
+			if v {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+		case int64:
+			buf.WriteByte(byte(ConstInt))
+			writeVarint(&buf, v)
+		case int:
+			buf.WriteByte(byte(ConstInt))
+			writeVarint(&buf, int64(v))
+		case float64:
+			buf.WriteByte(byte(ConstFloat))
+			writeUint64(&buf, math.Float64bits(v))
+		case string:
+			buf.WriteByte(byte(ConstString))
+			writeUvarint(&buf, uint64(len(v)))
+			buf.WriteString(v)
+		default:
+			panic(fmt.Sprintf("bytecode: unsupported constant type %T", c))
+		}
+	}
+	return buf.Bytes()
+}
+
+func unmarshalConstants(b []byte) ([]interface{}, error) {
+	r := bytes.NewReader(b)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, count)
+	for i := range out {
+		kindByte, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch ConstKind(kindByte) {
+		case ConstNil:
+			out[i] = nil
+		case ConstBool:
+			v, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v != 0
+		case ConstInt:
+			v, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		case ConstFloat:
+			var bits uint64
+			if err := binary.Read(r, binary.LittleEndian, &bits); err != nil {
+				return nil, err
+			}
+			out[i] = math.Float64frombits(bits)
+		case ConstString:
+			l, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			s := make([]byte, l)
+			if _, err := r.Read(s); err != nil {
+				return nil, err
+			}
+			out[i] = string(s)
+		default:
+			return nil, fmt.Errorf("bytecode: unknown constant kind %d", kindByte)
+		}
+	}
+	return out, nil
+}
+
+func marshalFunctions(fns []FuncEntry) []byte {
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(len(fns)))
+	for _, fn := range fns {
+		writeUvarint(&buf, uint64(len(fn.Name)))
+		buf.WriteString(fn.Name)
+		writeUvarint(&buf, uint64(fn.Offset))
+		writeUvarint(&buf, uint64(fn.Length))
+	}
+	return buf.Bytes()
+}
+
+func unmarshalFunctions(b []byte) ([]FuncEntry, error) {
+	r := bytes.NewReader(b)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]FuncEntry, count)
+	for i := range out {
+		nameLen, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		name := make([]byte, nameLen)
+		if _, err := r.Read(name); err != nil {
+			return nil, err
+		}
+		offset, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = FuncEntry{Name: string(name), Offset: int(offset), Length: int(length)}
+	}
+	return out, nil
+}
+
+func marshalLines(lines []LineEntry) []byte {
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(len(lines)))
+	for _, l := range lines {
+		writeUvarint(&buf, uint64(l.PC))
+		writeUvarint(&buf, uint64(l.Line))
+	}
+	return buf.Bytes()
+}
+
+func unmarshalLines(b []byte) ([]LineEntry, error) {
+	r := bytes.NewReader(b)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]LineEntry, count)
+	for i := range out {
+		pc, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		line, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = LineEntry{PC: int(pc), Line: int(line)}
+	}
+	return out, nil
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	buf.Write(b[:n])
+}
+
+func writeVarint(buf *bytes.Buffer, v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	buf.Write(b[:n])
+}
@@ -0,0 +1,60 @@
+package bytecode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	prog := &Program{
+		Constants: []interface{}{nil, true, false, int64(42), 3.5, "hello"},
+		Code:      []byte{1, 2, 3, 4, 5},
+		Functions: []FuncEntry{
+			{Name: "main", Offset: 0, Length: 3},
+			{Name: "helper", Offset: 3, Length: 2},
+		},
+		Lines: []LineEntry{{PC: 0, Line: 1}, {PC: 3, Line: 2}},
+	}
+
+	got, err := Unmarshal(Marshal(prog))
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if !reflect.DeepEqual(got.Constants, prog.Constants) {
+		t.Errorf("Constants = %#v, want %#v", got.Constants, prog.Constants)
+	}
+	if !reflect.DeepEqual(got.Code, prog.Code) {
+		t.Errorf("Code = %#v, want %#v", got.Code, prog.Code)
+	}
+	if !reflect.DeepEqual(got.Functions, prog.Functions) {
+		t.Errorf("Functions = %#v, want %#v", got.Functions, prog.Functions)
+	}
+	if !reflect.DeepEqual(got.Lines, prog.Lines) {
+		t.Errorf("Lines = %#v, want %#v", got.Lines, prog.Lines)
+	}
+}
+
+func TestUnmarshalEmptyProgram(t *testing.T) {
+	prog := &Program{}
+	got, err := Unmarshal(Marshal(prog))
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(got.Constants) != 0 || len(got.Code) != 0 || len(got.Functions) != 0 || len(got.Lines) != 0 {
+		t.Errorf("expected all-empty Program, got %#v", got)
+	}
+}
+
+func TestUnmarshalBadMagic(t *testing.T) {
+	if _, err := Unmarshal([]byte("nope")); err == nil {
+		t.Error("expected error for bad magic, got nil")
+	}
+}
+
+func TestUnmarshalTruncatedTOC(t *testing.T) {
+	b := Marshal(&Program{})
+	if _, err := Unmarshal(b[:len(kbc3Magic)+4]); err == nil {
+		t.Error("expected error for truncated table of contents, got nil")
+	}
+}
@@ -0,0 +1,146 @@
+package bytecode
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"kyra/internal/parser"
+)
+
+// moduleFunctions accumulates the current module's compiled FuncDef/
+// FuncExprDef/FuncOneLiner bodies as their own Chunks, indexed by a
+// dense function id -- the same id a call site pushes (via
+// OP_CONST_F64) for OP_CALL/OP_SPAWN to resolve. moduleFuncIndex maps a
+// function's source name to that id so a call can resolve it whether
+// the definition appears before or after the call site. Both are
+// reset at the start of every EmitChunk, since (like gensymCounter in
+// internal/parser/macro.go) this package only ever compiles one module
+// at a time and a stale table would corrupt the next module's call
+// codegen.
+var (
+	moduleFunctions []*Chunk
+	moduleFuncIndex map[string]int
+)
+
+func resetFunctions() {
+	moduleFunctions = nil
+	moduleFuncIndex = map[string]int{}
+}
+
+// resolveFunction returns name's function id, declaring it as a forward
+// reference (reserving a slot with no body yet) if this is the first
+// time the module has mentioned it.
+func resolveFunction(name string) int {
+	if id, ok := moduleFuncIndex[name]; ok {
+		return id
+	}
+	id := len(moduleFunctions)
+	moduleFunctions = append(moduleFunctions, nil)
+	moduleFuncIndex[name] = id
+	return id
+}
+
+// emitFunctionDef compiles a block-bodied `func name(params): <block>`
+// into its own Chunk and registers it under resolveFunction(s.Name).
+// Params are bound from the arguments callFunction copied onto the new
+// frame's stack: since those arrive in push (left-to-right) order, the
+// last one pushed is on top, so params are stored in reverse so each
+// ends up bound to the right name.
+func emitFunctionDef(c *Chunk, s *parser.FuncDef) {
+	fn := compileFunction(s.Params, func(fn *Chunk) {
+		for _, st := range s.Body {
+			emitStmt(fn, st)
+		}
+	})
+	defineFunction(s.Name, fn)
+}
+
+// emitFunctionExpr compiles the `func name(params) -> expr` form: an
+// implicit-return single expression body.
+func emitFunctionExpr(c *Chunk, s *parser.FuncExprDef) {
+	fn := compileFunction(s.Params, func(fn *Chunk) {
+		emitExpr(fn, s.Expr)
+	})
+	defineFunction(s.Name, fn)
+}
+
+// emitFunctionOneLiner compiles the `func name(params): expr` form,
+// identical to emitFunctionExpr at the codegen level -- the parser only
+// distinguishes the two to tell `->` and `:` apart.
+func emitFunctionOneLiner(c *Chunk, s *parser.FuncOneLiner) {
+	fn := compileFunction(s.Params, func(fn *Chunk) {
+		emitExpr(fn, s.Expr)
+	})
+	defineFunction(s.Name, fn)
+}
+
+func compileFunction(params []parser.Param, body func(fn *Chunk)) *Chunk {
+	fn := NewChunk()
+	for i := len(params) - 1; i >= 0; i-- {
+		slot := fn.AddName(params[i].Name)
+		fn.emit(OP_STORE_NAME)
+		fn.emitInt(slot)
+	}
+	body(fn)
+	fn.emit(OP_RET)
+	return fn
+}
+
+func defineFunction(name string, fn *Chunk) {
+	moduleFunctions[resolveFunction(name)] = fn
+}
+
+// encodeModuleWithFunctions serializes main and every function the
+// module declared via resolveFunction to KBC v2 bytes: "KBC" + version
+// byte, a function count, each function's Chunk (in id order, so a
+// decoder's index into the table matches the id codegen assigned), and
+// finally the main Chunk -- the same order kvm.loadModule reads them
+// back in (see readChunk's callers there).
+func encodeModuleWithFunctions(main *Chunk) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("KBC")
+	buf.WriteByte(2)
+
+	writeUint32(&buf, uint32(len(moduleFunctions)))
+	for name, id := range moduleFuncIndex {
+		if moduleFunctions[id] == nil {
+			panic(fmt.Sprintf("bytecode: call to undefined function %q", name))
+		}
+	}
+	for _, fn := range moduleFunctions {
+		writeChunkSection(&buf, fn)
+	}
+	writeChunkSection(&buf, main)
+
+	return buf.Bytes()
+}
+
+// writeChunkSection writes one Chunk's typed constant pools -- Ints,
+// Floats, Strings, Names, in that order -- followed by its
+// length-prefixed code, mirroring the layout kvm.readChunk decodes.
+func writeChunkSection(buf *bytes.Buffer, c *Chunk) {
+	writeUint32(buf, uint32(len(c.Ints)))
+	for _, v := range c.Ints {
+		writeUint64(buf, uint64(v))
+	}
+
+	writeUint32(buf, uint32(len(c.Floats)))
+	for _, v := range c.Floats {
+		writeUint64(buf, math.Float64bits(v))
+	}
+
+	writeStringTable(buf, c.Strings)
+	writeStringTable(buf, c.Names)
+
+	writeUint32(buf, uint32(len(c.Code)))
+	buf.Write(c.Code)
+}
+
+func writeStringTable(buf *bytes.Buffer, strs []string) {
+	writeUint32(buf, uint32(len(strs)))
+	for _, s := range strs {
+		writeUint32(buf, uint32(len(s)))
+		buf.WriteString(s)
+	}
+}
@@ -0,0 +1,76 @@
+// Package diag provides structured diagnostics for the lexer, parser, and
+// VM, modeled loosely on codespan-reporting: diagnostics carry one or more
+// labeled source spans so a renderer can print the offending source line(s)
+// with a caret underlining the exact span, rather than a bare panic message.
+package diag
+
+// Severity classifies how serious a Diagnostic is.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// Span is a byte-offset range into a single file's source text.
+type Span struct {
+	FileID FileID
+	Start  int
+	End    int
+}
+
+// Label attaches a message to a Span. Primary labels point at the exact
+// location of the problem; secondary labels add context (e.g. "previous
+// definition was here").
+type Label struct {
+	Span      Span
+	Message   string
+	Primary   bool
+}
+
+// Diagnostic is a single error, warning, or note, with zero or more labeled
+// spans and free-standing notes shown after the rendered source.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Labels   []Label
+	Notes    []string
+}
+
+// NewError builds an Error-severity Diagnostic with a single primary label.
+func NewError(message string, span Span, labelMessage string) Diagnostic {
+	return Diagnostic{
+		Severity: Error,
+		Message:  message,
+		Labels: []Label{
+			{Span: span, Message: labelMessage, Primary: true},
+		},
+	}
+}
+
+// WithNote appends a free-standing note to the diagnostic and returns it.
+func (d Diagnostic) WithNote(note string) Diagnostic {
+	d.Notes = append(d.Notes, note)
+	return d
+}
+
+// WithSecondary appends a secondary (non-primary) label pointing at extra
+// context, such as where a value was first declared.
+func (d Diagnostic) WithSecondary(span Span, message string) Diagnostic {
+	d.Labels = append(d.Labels, Label{Span: span, Message: message})
+	return d
+}
@@ -0,0 +1,94 @@
+package diag
+
+import "strings"
+
+// FileID identifies a source file registered with a Files registry.
+type FileID int
+
+// Files is a registry mapping FileIDs to their name and source text, used
+// by the renderer to resolve a Span back to line/column text.
+type Files struct {
+	names   []string
+	sources []string
+	// lineStarts[i] holds the byte offset of the start of each line in
+	// sources[i], used to map a byte offset to a line number.
+	lineStarts [][]int
+}
+
+// NewFiles creates an empty file registry.
+func NewFiles() *Files {
+	return &Files{}
+}
+
+// Add registers a source file and returns its FileID.
+func (f *Files) Add(name, source string) FileID {
+	f.names = append(f.names, name)
+	f.sources = append(f.sources, source)
+	f.lineStarts = append(f.lineStarts, computeLineStarts(source))
+	return FileID(len(f.names) - 1)
+}
+
+// Name returns the registered name for id.
+func (f *Files) Name(id FileID) string {
+	if int(id) < 0 || int(id) >= len(f.names) {
+		return "<unknown>"
+	}
+	return f.names[id]
+}
+
+// Source returns the registered source text for id.
+func (f *Files) Source(id FileID) string {
+	if int(id) < 0 || int(id) >= len(f.sources) {
+		return ""
+	}
+	return f.sources[id]
+}
+
+// LineCol converts a byte offset into a 1-based line and column number.
+func (f *Files) LineCol(id FileID, offset int) (line, col int) {
+	if int(id) < 0 || int(id) >= len(f.lineStarts) {
+		return 0, 0
+	}
+	starts := f.lineStarts[id]
+	line = 1
+	for i, s := range starts {
+		if offset < s {
+			break
+		}
+		line = i + 1
+	}
+	lineStart := 0
+	if line-1 < len(starts) {
+		lineStart = starts[line-1]
+	}
+	return line, offset - lineStart + 1
+}
+
+// Line returns the text of the given 1-based line number, without its
+// trailing newline.
+func (f *Files) Line(id FileID, line int) string {
+	if int(id) < 0 || int(id) >= len(f.lineStarts) {
+		return ""
+	}
+	starts := f.lineStarts[id]
+	if line < 1 || line > len(starts) {
+		return ""
+	}
+	start := starts[line-1]
+	src := f.sources[id]
+	end := strings.IndexByte(src[start:], '\n')
+	if end == -1 {
+		return src[start:]
+	}
+	return src[start : start+end]
+}
+
+func computeLineStarts(source string) []int {
+	starts := []int{0}
+	for i, r := range source {
+		if r == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
@@ -0,0 +1,48 @@
+package diag
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Render prints each diagnostic to w in a terminal-friendly form: a header
+// line with severity and message, then for each label (primary or
+// secondary) the source line its span starts on with a caret underline
+// beneath the span.
+func Render(w io.Writer, files *Files, diagnostics []Diagnostic) {
+	for i, d := range diagnostics {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		renderOne(w, files, d)
+	}
+}
+
+func renderOne(w io.Writer, files *Files, d Diagnostic) {
+	fmt.Fprintf(w, "%s: %s\n", d.Severity, d.Message)
+
+	for _, label := range d.Labels {
+		line, col := files.LineCol(label.Span.FileID, label.Span.Start)
+		name := files.Name(label.Span.FileID)
+		fmt.Fprintf(w, "  --> %s:%d:%d\n", name, line, col)
+
+		text := files.Line(label.Span.FileID, line)
+		fmt.Fprintf(w, "   | %s\n", text)
+
+		width := label.Span.End - label.Span.Start
+		if width < 1 {
+			width = 1
+		}
+		caret := strings.Repeat(" ", col-1) + strings.Repeat("^", width)
+		fmt.Fprintf(w, "   | %s", caret)
+		if label.Message != "" {
+			fmt.Fprintf(w, " %s", label.Message)
+		}
+		fmt.Fprintln(w)
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "   = note: %s\n", note)
+	}
+}
@@ -0,0 +1,113 @@
+package kar
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Archive is an opened, verified .kar bundle. Every entry's digest has
+// already been checked against the manifest and the manifest's signature
+// against KYRA_VERIFY_KEY by the time Open returns one.
+type Archive struct {
+	entries map[string][]byte
+}
+
+// Open reads the .kar archive at path, verifies its manifest signature
+// and every entry's digest, and returns an Archive on success. It
+// refuses to load (returning an error) if the signature is invalid or
+// any entry's content doesn't match its recorded sha256, so a tampered
+// or corrupted archive is never silently accepted.
+func Open(path string) (*Archive, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("kar: opening %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	raw := map[string][]byte{}
+	for _, f := range zr.File {
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("kar: reading %s: %w", f.Name, err)
+		}
+		raw[f.Name] = content
+	}
+
+	manifestBytes, ok := raw[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("kar: archive is missing %s", manifestName)
+	}
+	signature, ok := raw[signatureName]
+	if !ok {
+		return nil, fmt.Errorf("kar: archive is missing %s", signatureName)
+	}
+
+	verifyKey, err := loadVerifyKey()
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(verifyKey, manifestBytes, signature) {
+		return nil, fmt.Errorf("kar: manifest signature verification failed")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("kar: decoding manifest: %w", err)
+	}
+
+	allowed := map[string]bool{manifestName: true, signatureName: true}
+	for _, entry := range manifest.Entries {
+		allowed[entry.Path] = true
+
+		content, ok := raw[entry.Path]
+		if !ok {
+			return nil, fmt.Errorf("kar: manifest lists %s but the archive doesn't contain it", entry.Path)
+		}
+		if int64(len(content)) != entry.Size {
+			return nil, fmt.Errorf("kar: %s has size %d, manifest says %d", entry.Path, len(content), entry.Size)
+		}
+		if got := sha256Hex(content); got != entry.SHA256 {
+			return nil, fmt.Errorf("kar: %s failed digest verification: got %s, want %s", entry.Path, got, entry.SHA256)
+		}
+	}
+
+	// A signed manifest only vouches for the entries it lists; an extra
+	// zip entry smuggled in alongside them would be served by Module
+	// without ever having its digest checked against anything, so the
+	// archive is rejected outright rather than silently tolerating it.
+	for name := range raw {
+		if !allowed[name] {
+			return nil, fmt.Errorf("kar: archive contains %s, which isn't listed in the manifest", name)
+		}
+	}
+
+	return &Archive{entries: raw}, nil
+}
+
+// Module returns the raw KBC bytes for the module named name (looked up
+// as "name.kbc"), for passing directly to kvm.New.
+func (a *Archive) Module(name string) ([]byte, error) {
+	content, ok := a.entries[name+".kbc"]
+	if !ok {
+		return nil, fmt.Errorf("kar: archive has no module %q", name)
+	}
+	return content, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, rc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,28 +1,126 @@
+// Package kar builds and reads .kar archives: zip files carrying a
+// MANIFEST.json of (path, size, sha256) entries and an Ed25519 signature
+// over that manifest, so a distributor's bundle is tamper-evident and a
+// crashed build never leaves a half-written archive behind.
 package kar
 
 import (
-    "archive/zip"
-    "os"
-    "path/filepath"
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
 )
 
-// Build creates a .kar archive from a project folder.
+// Build creates a signed .kar archive from a project folder. Every file
+// under project is packed in, plus a MANIFEST.json listing each entry's
+// path/size/sha256 and a manifest.sig holding the manifest's Ed25519
+// signature (key read from KYRA_SIGN_KEY). The archive is written
+// atomically: it's assembled in a temp file in the same directory, then
+// renamed into place, so a crash mid-write never leaves a half-written
+// .kar at the destination path.
 func Build(project string) error {
-    out, _ := os.Create(project + ".kar")
-    zw := zip.NewWriter(out)
-
-    filepath.Walk(project, func(path string, info os.FileInfo, err error) error {
-        if info.IsDir() {
-            return nil
-        }
-
-        rel, _ := filepath.Rel(project, path)
-        w, _ := zw.Create(rel)
-        data, _ := os.ReadFile(path)
-        w.Write(data)
-        return nil
-    })
-
-    zw.Close()
-    return nil
+	key, err := loadSigningKey()
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	var data [][]byte
+
+	err = filepath.Walk(project, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(project, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, rel)
+		data = append(data, content)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("kar: walking %s: %w", project, err)
+	}
+
+	manifest := buildManifest(paths, data)
+	manifestBytes, err := manifest.marshal()
+	if err != nil {
+		return fmt.Errorf("kar: encoding manifest: %w", err)
+	}
+	signature := ed25519.Sign(key, manifestBytes)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for i, path := range paths {
+		w, err := zw.Create(path)
+		if err != nil {
+			return fmt.Errorf("kar: adding %s: %w", path, err)
+		}
+		if _, err := w.Write(data[i]); err != nil {
+			return fmt.Errorf("kar: writing %s: %w", path, err)
+		}
+	}
+
+	if err := writeZipEntry(zw, manifestName, manifestBytes); err != nil {
+		return err
+	}
+	if err := writeZipEntry(zw, signatureName, signature); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("kar: finalizing archive: %w", err)
+	}
+
+	return atomicWriteFile(project+".kar", buf.Bytes())
+}
+
+func writeZipEntry(zw *zip.Writer, name string, content []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("kar: adding %s: %w", name, err)
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// atomicWriteFile writes data to a temp file beside path, then renames it
+// into place, so a process crash during the write leaves no partial file
+// visible at path.
+func atomicWriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("kar: creating temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("kar: writing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("kar: closing temp file: %w", err)
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("kar: renaming into place: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,51 @@
+package kar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// manifestName is the entry inside a .kar archive listing every other
+// entry's path, size, and digest.
+const manifestName = "MANIFEST.json"
+
+// signatureName is the entry holding manifestName's Ed25519 signature.
+const signatureName = "manifest.sig"
+
+// ManifestEntry describes one file packed into a .kar archive.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists every entry in a .kar archive, in the order they were
+// added to the zip.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// buildManifest computes a ManifestEntry for each (path, data) pair, in
+// the order given.
+func buildManifest(paths []string, data [][]byte) Manifest {
+	m := Manifest{Entries: make([]ManifestEntry, len(paths))}
+	for i, path := range paths {
+		sum := sha256.Sum256(data[i])
+		m.Entries[i] = ManifestEntry{
+			Path:   path,
+			Size:   int64(len(data[i])),
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+	}
+	return m
+}
+
+func (m Manifest) marshal() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,87 @@
+package kar
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// signKeyEnv names the environment variable pointing at the Ed25519
+// private key file used to sign a manifest on Build.
+const signKeyEnv = "KYRA_SIGN_KEY"
+
+// verifyKeyEnv names the environment variable pointing at the Ed25519
+// public key file used to verify a manifest's signature on Open.
+const verifyKeyEnv = "KYRA_VERIFY_KEY"
+
+// loadSigningKey reads the Ed25519 private key Build signs with from the
+// file at KYRA_SIGN_KEY. The file may hold either a 32-byte seed or a
+// full 64-byte private key, hex-encoded.
+func loadSigningKey() (ed25519.PrivateKey, error) {
+	path := os.Getenv(signKeyEnv)
+	if path == "" {
+		return nil, fmt.Errorf("kar: %s is not set; cannot sign archive", signKeyEnv)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("kar: reading signing key: %w", err)
+	}
+	key, err := decodeKeyHex(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, fmt.Errorf("kar: signing key at %s has unexpected length %d", path, len(key))
+	}
+}
+
+// loadVerifyKey reads the Ed25519 public key Open verifies against from
+// the file at KYRA_VERIFY_KEY.
+func loadVerifyKey() (ed25519.PublicKey, error) {
+	path := os.Getenv(verifyKeyEnv)
+	if path == "" {
+		return nil, fmt.Errorf("kar: %s is not set; cannot verify archive signature", verifyKeyEnv)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("kar: reading verify key: %w", err)
+	}
+	key, err := decodeKeyHex(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("kar: verify key at %s has unexpected length %d", path, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func decodeKeyHex(raw []byte) ([]byte, error) {
+	trimmed := trimKeyWhitespace(raw)
+	key, err := hex.DecodeString(string(trimmed))
+	if err != nil {
+		return nil, fmt.Errorf("kar: key file is not valid hex: %w", err)
+	}
+	return key, nil
+}
+
+func trimKeyWhitespace(raw []byte) []byte {
+	start, end := 0, len(raw)
+	for start < end && isSpace(raw[start]) {
+		start++
+	}
+	for end > start && isSpace(raw[end-1]) {
+		end--
+	}
+	return raw[start:end]
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
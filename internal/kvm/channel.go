@@ -0,0 +1,84 @@
+package kvm
+
+// Channel is a bounded value channel used by OP_CHAN_SEND/OP_CHAN_RECV.
+// Unlike a Go channel, blocking is cooperative: a Thread that can't
+// proceed is parked on sendWaiters/recvWaiters and the scheduler resumes
+// it once the other side operates, rather than blocking an OS thread.
+type Channel struct {
+	capacity int
+	buf      []interface{}
+
+	sendWaiters []pendingSend
+	recvWaiters []*Thread
+}
+
+// pendingSend is a Thread blocked in OP_CHAN_SEND along with the value it
+// was trying to send, so that once a receiver (or buffer space) frees up
+// the value is still available to hand off.
+type pendingSend struct {
+	thread *Thread
+	value  interface{}
+}
+
+func newChannel(capacity int) *Channel {
+	return &Channel{capacity: capacity}
+}
+
+// trySend attempts to buffer v without blocking, handing it directly to
+// a waiting receiver if there is one. It returns false if the channel is
+// full and no receiver is waiting, in which case the caller must park the
+// sending thread on sendWaiters with its value instead.
+func (c *Channel) trySend(v interface{}) bool {
+	if len(c.recvWaiters) > 0 {
+		recv := c.recvWaiters[0]
+		c.recvWaiters = c.recvWaiters[1:]
+		recv.push(v)
+		recv.state = threadRunnable
+		return true
+	}
+	if len(c.buf) >= c.capacity {
+		return false
+	}
+	c.buf = append(c.buf, v)
+	return true
+}
+
+// tryRecv attempts to take a value without blocking, waking the oldest
+// parked sender (if any) to take its place in the buffer. ok is false if
+// the channel is empty and the caller must park the receiving thread on
+// recvWaiters instead.
+func (c *Channel) tryRecv() (v interface{}, ok bool) {
+	if len(c.buf) > 0 {
+		v = c.buf[0]
+		c.buf = c.buf[1:]
+	} else if len(c.sendWaiters) > 0 {
+		send := c.sendWaiters[0]
+		c.sendWaiters = c.sendWaiters[1:]
+		send.thread.state = threadRunnable
+		return send.value, true
+	} else {
+		return nil, false
+	}
+
+	if len(c.sendWaiters) > 0 {
+		send := c.sendWaiters[0]
+		c.sendWaiters = c.sendWaiters[1:]
+		c.buf = append(c.buf, send.value)
+		send.thread.state = threadRunnable
+	}
+	return v, true
+}
+
+// parkSend records a blocked thread waiting to send v.
+func (c *Channel) parkSend(t *Thread, v interface{}) {
+	t.state = threadBlocked
+	t.blockedOn = c
+	c.sendWaiters = append(c.sendWaiters, pendingSend{thread: t, value: v})
+}
+
+// parkRecv records a blocked thread waiting to receive.
+func (c *Channel) parkRecv(t *Thread) {
+	t.state = threadBlocked
+	t.blockedOn = c
+	c.recvWaiters = append(c.recvWaiters, t)
+}
@@ -0,0 +1,33 @@
+package kvm
+
+import "fmt"
+
+// moduleFunctions holds every function Chunk decoded from the module
+// currently loaded by loadModule, indexed by the same function id
+// bytecode.EmitChunk assigned at compile time -- callFunction and spawn
+// resolve a callee here via loadFunction. Mirrors
+// bytecode.moduleFunctions on the decode side of the same KBC module:
+// like that table, this package only ever runs one loaded module at a
+// time, so loadModule simply replaces it rather than keying it per-VM.
+var moduleFunctions []funcChunk
+
+// funcChunk is one function's decoded code and typed constant pools,
+// the same five values loadFunction hands back to callFunction/spawn.
+type funcChunk struct {
+	code    []byte
+	ints    []int64
+	floats  []float64
+	strings []string
+	names   []string
+}
+
+// loadFunction looks up fnID (as pushed onto the stack by the caller's
+// OP_CONST_F64 before OP_CALL/OP_SPAWN) in moduleFunctions, panicking on
+// an out-of-range id the way every other VM error does.
+func loadFunction(fnID int) (code []byte, ints []int64, floats []float64, strings []string, names []string) {
+	if fnID < 0 || fnID >= len(moduleFunctions) {
+		panic(fmt.Sprintf("call to undefined function id %d", fnID))
+	}
+	fn := moduleFunctions[fnID]
+	return fn.code, fn.ints, fn.floats, fn.strings, fn.names
+}
@@ -4,28 +4,82 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"time"
+
+	"kyra/internal/diag"
 )
 
 // ---------------------------
 // VM structures
 // ---------------------------
 
+// VM holds state shared across every green Thread it schedules: host
+// bindings for FFI, and the deadline/op-budget limits an embedder set via
+// kyra.WithTimeout/WithOpBudget. Per-thread execution state (ip, stack,
+// call stack) lives on Thread instead, since OP_SPAWN lets a module run
+// more than one of these concurrently.
 type VM struct {
-	constants []interface{}
-	code      []byte
+	mainCode    []byte
+	mainInts    []int64
+	mainFloats  []float64
+	mainStrings []string
+	mainNames   []string
+
+	// hostFuncs holds Go callables registered via Bind, dispatched by
+	// OP_HOSTCALL for embedder FFI.
+	hostFuncs map[string]func([]any) (any, error)
+
+	// deadline and opBudget bound an embedded Program's execution; either
+	// may be zero to mean "no limit". Checked once every
+	// opBudgetCheckEvery instructions rather than every instruction to
+	// keep the hot loop cheap, so a run can overshoot either limit by up
+	// to that many instructions before it aborts.
+	deadline time.Time
+	opBudget int
+	opCount  int
+
+	channels     []*Channel
+	nextThreadID int
+
+	// parked holds every Thread not currently in the scheduler's run
+	// queue: either blocked on a channel op, or newly spawned and not yet
+	// picked up. runScheduler moves entries back to the queue once
+	// they're runnable again, and reports a deadlock if it ever empties
+	// the queue with channel-blocked threads still waiting.
+	parked []*Thread
+}
+
+const opBudgetCheckEvery = 256
 
-	ip    int
-	sp    int
-	stack []interface{}
+// Bind registers fn as a host builtin callable from Kyra under name, via
+// OP_HOSTCALL. Used by the embeddable kyra package to surface
+// WithBuiltins/env entries as identifiers.
+func (vm *VM) Bind(name string, fn func([]any) (any, error)) {
+	if vm.hostFuncs == nil {
+		vm.hostFuncs = map[string]func([]any) (any, error){}
+	}
+	vm.hostFuncs[name] = fn
+}
 
-	callStack []Frame
+// SetDeadline bounds wall-clock execution; Run aborts once it's passed.
+func (vm *VM) SetDeadline(t time.Time) {
+	vm.deadline = t
+}
+
+// SetOpBudget bounds the number of instructions Run may execute.
+func (vm *VM) SetOpBudget(n int) {
+	vm.opBudget = n
 }
 
 type Frame struct {
 	ipBackup int
 	spBackup int
 	code     []byte
-	consts   []interface{}
+	ints     []int64
+	floats   []float64
+	strings  []string
+	names    []string
+	vars     map[string]interface{}
 }
 
 // ---------------------------
@@ -33,14 +87,71 @@ type Frame struct {
 // ---------------------------
 
 func New(code []byte) *VM {
-	vm := &VM{
-		stack:     make([]interface{}, 0, 1024),
-		callStack: []Frame{},
-	}
+	vm := &VM{}
 	vm.loadModule(code)
 	return vm
 }
 
+// readInts decodes a bytecode.Chunk.Ints-style sub-table: a uint32 count
+// followed by that many 8-byte little-endian int64 entries.
+func readInts(code []byte, offset int) (vals []int64, newOffset int) {
+	count := int(binary.LittleEndian.Uint32(code[offset:]))
+	offset += 4
+	vals = make([]int64, count)
+	for i := 0; i < count; i++ {
+		vals[i] = int64(binary.LittleEndian.Uint64(code[offset:]))
+		offset += 8
+	}
+	return vals, offset
+}
+
+// readFloats decodes a Chunk.Floats-style sub-table: a uint32 count
+// followed by that many 8-byte IEEE-754 float64 entries.
+func readFloats(code []byte, offset int) (vals []float64, newOffset int) {
+	count := int(binary.LittleEndian.Uint32(code[offset:]))
+	offset += 4
+	vals = make([]float64, count)
+	for i := 0; i < count; i++ {
+		bits := binary.LittleEndian.Uint64(code[offset:])
+		vals[i] = math.Float64frombits(bits)
+		offset += 8
+	}
+	return vals, offset
+}
+
+// readStrings decodes a Chunk.Strings/Names-style sub-table: a uint32
+// count followed by that many length-prefixed strings.
+func readStrings(code []byte, offset int) (vals []string, newOffset int) {
+	count := int(binary.LittleEndian.Uint32(code[offset:]))
+	offset += 4
+	vals = make([]string, count)
+	for i := 0; i < count; i++ {
+		l := int(binary.LittleEndian.Uint32(code[offset:]))
+		offset += 4
+		vals[i] = string(code[offset : offset+l])
+		offset += l
+	}
+	return vals, offset
+}
+
+// readChunk decodes one bytecode.Chunk's typed constant pools --
+// Ints, Floats, Strings, Names, in that order -- followed by its code
+// section, starting at offset. It returns the decoded pools, code, and
+// the offset just past the chunk.
+func readChunk(code []byte, offset int) (ints []int64, floats []float64, strs []string, names []string, chunkCode []byte, newOffset int) {
+	ints, offset = readInts(code, offset)
+	floats, offset = readFloats(code, offset)
+	strs, offset = readStrings(code, offset)
+	names, offset = readStrings(code, offset)
+
+	l := int(binary.LittleEndian.Uint32(code[offset:]))
+	offset += 4
+	chunkCode = code[offset : offset+l]
+	offset += l
+
+	return ints, floats, strs, names, chunkCode, offset
+}
+
 func (vm *VM) loadModule(code []byte) {
 	// Header: KBC + version
 	if string(code[:3]) != "KBC" {
@@ -58,278 +169,383 @@ func (vm *VM) loadModule(code []byte) {
 	fnCount := int(binary.LittleEndian.Uint32(code[offset:]))
 	offset += 4
 
-	// Skip function chunks (lazy load)
+	moduleFunctions = make([]funcChunk, fnCount)
 	for i := 0; i < fnCount; i++ {
-		// constants
-		cCount := int(binary.LittleEndian.Uint32(code[offset:]))
-		offset += 4
-
-		for j := 0; j < cCount; j++ {
-			kind := code[offset]
-			offset++
-
-			switch kind {
-			case 1: // string
-				l := int(binary.LittleEndian.Uint32(code[offset:]))
-				offset += 4 + l
-			case 2: // float64
-				offset += 8
-			case 3: // int
-				offset += 4
-			default:
-				panic("Unknown constant type in function chunk")
-			}
-		}
-
-		// code
-		l := int(binary.LittleEndian.Uint32(code[offset:]))
-		offset += 4 + l
+		ints, floats, strs, names, fnCode, next := readChunk(code, offset)
+		moduleFunctions[i] = funcChunk{code: fnCode, ints: ints, floats: floats, strings: strs, names: names}
+		offset = next
 	}
 
 	// Main chunk
-	cCount := int(binary.LittleEndian.Uint32(code[offset:]))
-	offset += 4
-
-	vm.constants = make([]interface{}, cCount)
-
-	for i := 0; i < cCount; i++ {
-		kind := code[offset]
-		offset++
-
-		switch kind {
-		case 1: // string
-			l := int(binary.LittleEndian.Uint32(code[offset:]))
-			offset += 4
-			str := string(code[offset : offset+l])
-			offset += l
-			vm.constants[i] = str
-
-		case 2: // float64
-			bits := binary.LittleEndian.Uint64(code[offset:])
-			offset += 8
-			vm.constants[i] = math.Float64frombits(bits)
-
-		case 3: // int
-			v := int(binary.LittleEndian.Uint32(code[offset:]))
-			offset += 4
-			vm.constants[i] = v
-
-		default:
-			panic("Unknown constant type in main chunk")
-		}
-	}
-
-	codeLen := int(binary.LittleEndian.Uint32(code[offset:]))
-	offset += 4
+	ints, floats, strs, names, mainCode, _ := readChunk(code, offset)
 
-	vm.code = code[offset : offset+codeLen]
-	vm.ip = 0
-	vm.sp = 0
+	vm.mainInts = ints
+	vm.mainFloats = floats
+	vm.mainStrings = strs
+	vm.mainNames = names
+	vm.mainCode = mainCode
 }
 
 // ---------------------------
-// Stack helpers
+// Execution
 // ---------------------------
 
-func (vm *VM) push(v interface{}) {
-	vm.stack = append(vm.stack, v)
-	vm.sp++
+// Run drives the scheduler starting from a single main Thread over
+// mainCode and its typed constant pools until every thread finishes or
+// every remaining thread is blocked on a channel (a deadlock, which
+// panics with every blocked thread's id and ip). It returns the main
+// thread's OP_RET value, same as the pre-green-thread single-threaded
+// Run did.
+func (vm *VM) Run() interface{} {
+	main := newThread(vm.newThreadID(), vm.mainCode, vm.mainInts, vm.mainFloats, vm.mainStrings, vm.mainNames)
+	return vm.runScheduler(main)
 }
 
-func (vm *VM) pop() interface{} {
-	if vm.sp == 0 {
-		panic("Stack underflow")
-	}
-	vm.sp--
-	v := vm.stack[vm.sp]
-	vm.stack = vm.stack[:vm.sp]
-	return v
+func (vm *VM) newThreadID() int {
+	id := vm.nextThreadID
+	vm.nextThreadID++
+	return id
 }
 
-func (vm *VM) peek() interface{} {
-	if vm.sp == 0 {
-		panic("Stack empty")
-	}
-	return vm.stack[vm.sp-1]
-}
+// step executes up to quantum instructions of t, or fewer if t finishes,
+// blocks on a channel, or yields first. This is what Run's loop used to
+// be, before green threads made it per-Thread instead of per-VM.
+func (t *Thread) step(vm *VM) {
+	for i := 0; i < quantum; i++ {
+		if t.ip >= len(t.code) {
+			t.state = threadDone
+			return
+		}
 
-// ---------------------------
-// Execution
-// ---------------------------
+		vm.opCount++
+		if vm.opCount%opBudgetCheckEvery == 0 {
+			if vm.opBudget > 0 && vm.opCount > vm.opBudget {
+				panic(fmt.Sprintf("op budget of %d instructions exceeded", vm.opBudget))
+			}
+			if !vm.deadline.IsZero() && time.Now().After(vm.deadline) {
+				panic("execution deadline exceeded")
+			}
+		}
 
-func (vm *VM) Run() interface{} {
-	for vm.ip < len(vm.code) {
-		op := vm.code[vm.ip]
-		vm.ip++
+		op := t.code[t.ip]
+		t.ip++
 
 		switch op {
 
-		case 0x01: // OP_CONST
-			idx := vm.readInt()
-			vm.push(vm.constants[idx])
+		case 0x01, 0x10, 0x11: // OP_CONST, OP_LOAD, OP_STORE (superseded)
+			panic("OP_CONST/OP_LOAD/OP_STORE are superseded by the typed " +
+				"OP_CONST_I64/F64/STR and OP_LOAD_NAME/OP_STORE_NAME opcodes; " +
+				"see bytecode.Chunk")
 
 		case 0x02: // OP_ADD
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(a + b)
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(a + b)
 
 		case 0x03: // OP_SUB
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(a - b)
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(a - b)
 
 		case 0x04: // OP_MUL
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(a * b)
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(a * b)
 
 		case 0x05: // OP_DIV
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(a / b)
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(a / b)
 
 		case 0x06: // OP_MOD
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(math.Mod(a, b))
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(math.Mod(a, b))
 
 		case 0x07: // OP_EQ
-			b := vm.pop()
-			a := vm.pop()
-			vm.push(boolToFloat(a == b))
+			b := t.pop()
+			a := t.pop()
+			t.push(boolToFloat(a == b))
 
 		case 0x08: // OP_NEQ
-			b := vm.pop()
-			a := vm.pop()
-			vm.push(boolToFloat(a != b))
+			b := t.pop()
+			a := t.pop()
+			t.push(boolToFloat(a != b))
 
 		case 0x09: // OP_LT
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(boolToFloat(a < b))
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(boolToFloat(a < b))
 
 		case 0x0A: // OP_GT
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(boolToFloat(a > b))
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(boolToFloat(a > b))
 
 		case 0x0B: // OP_LE
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(boolToFloat(a <= b))
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(boolToFloat(a <= b))
 
 		case 0x0C: // OP_GE
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(boolToFloat(a >= b))
+			b := t.pop().(float64)
+			a := t.pop().(float64)
+			t.push(boolToFloat(a >= b))
 
-		case 0x0D: // OP_AND
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(boolToFloat(a != 0 && b != 0))
+		case 0x0D: // OP_AND (superseded by short-circuit &&/|| codegen; kept for completeness)
+			b := t.pop()
+			a := t.pop()
+			t.push(boolToFloat(truthy(a) && truthy(b)))
 
-		case 0x0E: // OP_OR
-			b := vm.pop().(float64)
-			a := vm.pop().(float64)
-			vm.push(boolToFloat(a != 0 || b != 0))
+		case 0x0E: // OP_OR (superseded by short-circuit &&/|| codegen; kept for completeness)
+			b := t.pop()
+			a := t.pop()
+			t.push(boolToFloat(truthy(a) || truthy(b)))
 
 		case 0x0F: // OP_NOT
-			a := vm.pop().(float64)
-			vm.push(boolToFloat(a == 0))
-
-		case 0x10: // OP_LOAD
-			idx := vm.readInt()
-			vm.push(vm.constants[idx])
-
-		case 0x11: // OP_STORE
-			idx := vm.readInt()
-			val := vm.pop()
-			vm.constants[idx] = val
+			a := t.pop()
+			t.push(boolToFloat(!truthy(a)))
 
 		case 0x12: // OP_CALL
-			argCount := vm.readInt()
-			fnID := int(vm.pop().(float64))
-			vm.callFunction(fnID, argCount)
+			argCount := t.readInt()
+			fnID := int(t.pop().(float64))
+			t.callFunction(fnID, argCount)
 
 		case 0x13: // OP_RET
-			if len(vm.callStack) == 0 {
-				return vm.pop()
+			if len(t.callStack) == 0 {
+				t.result = t.pop()
+				t.state = threadDone
+				return
 			}
-			vm.returnFromFunction()
+			t.returnFromFunction()
 
 		case 0x14: // OP_JMP
-			target := vm.readInt()
-			vm.ip = target
+			target := t.readInt()
+			t.ip = target
 
 		case 0x15: // OP_JMPF
-			target := vm.readInt()
-			cond := vm.pop().(float64)
-			if cond == 0 {
-				vm.ip = target
+			target := t.readInt()
+			if !truthy(t.pop()) {
+				t.ip = target
 			}
 
 		case 0x16: // OP_POP
-			vm.pop()
+			t.pop()
 
 		case 0x17: // OP_EXIT
-			return nil
+			t.state = threadDone
+			return
+
+		case 0x18: // OP_HOSTCALL
+			nameIdx := t.readInt()
+			argCount := t.readInt()
+			vm.callHostFunc(t, nameIdx, argCount)
+
+		case 0x19: // OP_SPAWN
+			fnID := int(t.pop().(float64))
+			argCount := t.readInt()
+			vm.spawn(t, fnID, argCount)
+
+		case 0x1A: // OP_CHAN_MAKE
+			capacity := t.readInt()
+			ch := newChannel(capacity)
+			vm.channels = append(vm.channels, ch)
+			t.push(ch)
+
+		case 0x1B: // OP_CHAN_SEND
+			ch := t.pop().(*Channel)
+			val := t.pop()
+			if !ch.trySend(val) {
+				ch.parkSend(t, val)
+				return
+			}
+
+		case 0x1C: // OP_CHAN_RECV
+			ch := t.pop().(*Channel)
+			val, ok := ch.tryRecv()
+			if !ok {
+				ch.parkRecv(t)
+				return
+			}
+			t.push(val)
+
+		case 0x1D: // OP_YIELD
+			return
+
+		case 0x1E: // OP_CONST_I64
+			idx := t.readInt()
+			t.push(t.ints[idx])
+
+		case 0x1F: // OP_CONST_F64
+			idx := t.readInt()
+			t.push(t.floats[idx])
+
+		case 0x20: // OP_CONST_STR
+			idx := t.readInt()
+			t.push(t.strings[idx])
+
+		case 0x21: // OP_LOAD_NAME
+			idx := t.readInt()
+			t.push(t.vars[t.names[idx]])
+
+		case 0x22: // OP_STORE_NAME
+			idx := t.readInt()
+			val := t.pop()
+			t.vars[t.names[idx]] = val
+
+		case 0x23: // OP_JMPT
+			target := t.readInt()
+			if truthy(t.pop()) {
+				t.ip = target
+			}
+
+		case 0x24: // OP_STORE_ZERO
+			idx := t.readInt()
+			t.vars[t.names[idx]] = int64(0)
 
 		default:
 			panic(fmt.Sprintf("Unknown opcode: %02X", op))
 		}
 	}
+}
 
-	return nil
+// RunSafe runs the VM like Run, but recovers from the panics that type
+// mismatches (t.pop().(float64)) and stack underflows currently raise,
+// returning them as a Diagnostic instead of crashing the process. The
+// emitted Diagnostic currently carries no source Span: the KBC format has
+// no debug-info section yet to map an ip back to a source offset, so the
+// message is reported without an underlined source line.
+func (vm *VM) RunSafe() (result interface{}, diags []diag.Diagnostic) {
+	defer func() {
+		if r := recover(); r != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Message:  fmt.Sprint(r),
+			})
+			result = nil
+		}
+	}()
+
+	return vm.Run(), nil
 }
 
 // ---------------------------
 // Function calls
 // ---------------------------
 
-func (vm *VM) callFunction(fnID int, argCount int) {
-	fnCode, fnConsts := loadFunction(fnID)
+func (t *Thread) callFunction(fnID int, argCount int) {
+	fnCode, fnInts, fnFloats, fnStrings, fnNames := loadFunction(fnID)
 
 	frame := Frame{
-		ipBackup: vm.ip,
-		spBackup: vm.sp - argCount,
-		code:     vm.code,
-		consts:   vm.constants,
+		ipBackup: t.ip,
+		spBackup: t.sp - argCount,
+		code:     t.code,
+		ints:     t.ints,
+		floats:   t.floats,
+		strings:  t.strings,
+		names:    t.names,
+		vars:     t.vars,
 	}
 
-	vm.callStack = append(vm.callStack, frame)
+	t.callStack = append(t.callStack, frame)
 
-	vm.code = fnCode
-	vm.constants = fnConsts
-	vm.ip = 0
-	vm.sp = 0
+	t.code = fnCode
+	t.ints = fnInts
+	t.floats = fnFloats
+	t.strings = fnStrings
+	t.names = fnNames
+	t.vars = map[string]interface{}{}
+	t.ip = 0
+	t.sp = 0
 
 	for i := 0; i < argCount; i++ {
-		vm.push(vm.stack[frame.spBackup+i])
+		t.push(t.stack[frame.spBackup+i])
 	}
 }
 
-func (vm *VM) returnFromFunction() {
-	ret := vm.pop()
+func (t *Thread) returnFromFunction() {
+	ret := t.pop()
+
+	frame := t.callStack[len(t.callStack)-1]
+	t.callStack = t.callStack[:len(t.callStack)-1]
+
+	t.code = frame.code
+	t.ints = frame.ints
+	t.floats = frame.floats
+	t.strings = frame.strings
+	t.names = frame.names
+	t.vars = frame.vars
+	t.ip = frame.ipBackup
+	t.sp = frame.spBackup
+
+	t.push(ret)
+}
+
+// spawn implements OP_SPAWN: it pops argCount arguments off the spawning
+// thread's stack, creates a new Thread over fnID's code and typed pools,
+// seeds its stack with those arguments, and pushes a thread-handle
+// constant (the new Thread's id) back onto the spawning thread's stack.
+// The new thread is picked up by runScheduler on its next pass over the
+// parked/queued threads the same as any other runnable one.
+func (vm *VM) spawn(spawner *Thread, fnID int, argCount int) {
+	fnCode, fnInts, fnFloats, fnStrings, fnNames := loadFunction(fnID)
+
+	args := make([]interface{}, argCount)
+	for i := argCount - 1; i >= 0; i-- {
+		args[i] = spawner.pop()
+	}
 
-	frame := vm.callStack[len(vm.callStack)-1]
-	vm.callStack = vm.callStack[:len(vm.callStack)-1]
+	child := newThread(vm.newThreadID(), fnCode, fnInts, fnFloats, fnStrings, fnNames)
+	for _, a := range args {
+		child.push(a)
+	}
 
-	vm.code = frame.code
-	vm.constants = frame.consts
-	vm.ip = frame.ipBackup
-	vm.sp = frame.spBackup
+	vm.parked = append(vm.parked, child)
+	spawner.push(float64(child.id))
+}
 
-	vm.push(ret)
+// callHostFunc implements OP_HOSTCALL: it pops argCount arguments (pushed
+// left-to-right, so popped in reverse), looks up the host callable bound
+// under the name constant at nameIdx, and pushes its return value. A
+// failing call or an unbound name panics, same as any other VM error, and
+// is surfaced as a Diagnostic by RunSafe.
+func (vm *VM) callHostFunc(t *Thread, nameIdx, argCount int) {
+	name := t.names[nameIdx]
+
+	fn, ok := vm.hostFuncs[name]
+	if !ok {
+		panic(fmt.Sprintf("OP_HOSTCALL: no host function bound for %q", name))
+	}
+
+	args := make([]interface{}, argCount)
+	for i := argCount - 1; i >= 0; i-- {
+		args[i] = t.pop()
+	}
+
+	result, err := fn(args)
+	if err != nil {
+		panic(fmt.Sprintf("host call to %q failed: %v", name, err))
+	}
+	t.push(result)
 }
 
 // ---------------------------
 // Helpers
 // ---------------------------
 
-func (vm *VM) readInt() int {
-	v := int(binary.LittleEndian.Uint32(vm.code[vm.ip:]))
-	vm.ip += 4
-	return v
+// truthy evaluates v as a condition for OP_JMPF/OP_JMPT/OP_NOT/OP_AND/
+// OP_OR. Most conditions arrive as the float64 OP_EQ/OP_LT/etc. push, but
+// OP_CONST_I64 (literals, and OP_STORE_ZERO's implicit 0) pushes int64,
+// so both are accepted here rather than assuming one representation.
+func truthy(v interface{}) bool {
+	switch n := v.(type) {
+	case float64:
+		return n != 0
+	case int64:
+		return n != 0
+	default:
+		panic(fmt.Sprintf("expected a numeric condition, got %T", v))
+	}
 }
 
 func boolToFloat(b bool) float64 {
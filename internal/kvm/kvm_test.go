@@ -0,0 +1,222 @@
+package kvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// The opcodes below mirror the literal byte values kvm.go's Thread.step
+// switches on. There is no shared constant for them on this side of the
+// format (internal/bytecode owns codegen; internal/kvm only decodes and
+// interprets), so a kvm-level test that builds bytecode directly has to
+// spell them out the same way Thread.step's case labels do.
+const (
+	opAdd       = 0x02
+	opCall      = 0x12
+	opRet       = 0x13
+	opPop       = 0x16
+	opSpawn     = 0x19
+	opChanMake  = 0x1A
+	opChanSend  = 0x1B
+	opChanRecv  = 0x1C
+	opConstI64  = 0x1E
+	opConstF64  = 0x1F
+	opLoadName  = 0x21
+	opStoreName = 0x22
+)
+
+// rawChunk is a hand-assembled analogue of bytecode.Chunk: its typed
+// constant pools plus a finished code section, built directly rather than
+// through the emitter, so these tests can drive internal/kvm exactly the
+// way a decoded KBC v2 module would without depending on internal/bytecode.
+type rawChunk struct {
+	ints    []int64
+	floats  []float64
+	strings []string
+	names   []string
+	code    []byte
+}
+
+// encode serializes a rawChunk to the same Ints/Floats/Strings/Names/Code
+// layout readChunk decodes.
+func (c rawChunk) encode() []byte {
+	var buf bytes.Buffer
+
+	writeUint32(&buf, uint32(len(c.ints)))
+	for _, v := range c.ints {
+		writeUint64(&buf, uint64(v))
+	}
+
+	writeUint32(&buf, uint32(len(c.floats)))
+	for _, v := range c.floats {
+		writeUint64(&buf, math.Float64bits(v))
+	}
+
+	writeStrings(&buf, c.strings)
+	writeStrings(&buf, c.names)
+
+	writeUint32(&buf, uint32(len(c.code)))
+	buf.Write(c.code)
+
+	return buf.Bytes()
+}
+
+func writeStrings(buf *bytes.Buffer, strs []string) {
+	writeUint32(buf, uint32(len(strs)))
+	for _, s := range strs {
+		writeUint32(buf, uint32(len(s)))
+		buf.WriteString(s)
+	}
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+// buildModule assembles a full KBC v2 module (header, function table, then
+// the main chunk) exactly as loadModule expects to decode it.
+func buildModule(fns []rawChunk, main rawChunk) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("KBC")
+	buf.WriteByte(2)
+	writeUint32(&buf, uint32(len(fns)))
+	for _, fn := range fns {
+		buf.Write(fn.encode())
+	}
+	buf.Write(main.encode())
+	return buf.Bytes()
+}
+
+// op appends an opcode with its little-endian uint32 operands, the same
+// width Thread.readInt expects.
+func op(code []byte, b byte, operands ...int) []byte {
+	code = append(code, b)
+	for _, v := range operands {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(v))
+		code = append(code, buf[:]...)
+	}
+	return code
+}
+
+// TestRunSingleThreadArithmetic exercises the scheduler's ordinary path: one
+// thread, no spawns or channels, running to completion via OP_RET.
+func TestRunSingleThreadArithmetic(t *testing.T) {
+	var code []byte
+	code = op(code, opConstF64, 0) // 2
+	code = op(code, opConstF64, 1) // 3
+	code = op(code, opAdd)
+	code = op(code, opRet)
+
+	main := rawChunk{floats: []float64{2, 3}, code: code}
+	vm := New(buildModule(nil, main))
+
+	got := vm.Run()
+	if got != 5.0 {
+		t.Fatalf("Run() = %v, want 5.0", got)
+	}
+}
+
+// TestRunFunctionCall exercises OP_CALL/OP_RET the way chunk0-3's
+// function-emission codegen now drives them: the callee's function id
+// pushed via OP_CONST_F64 (matching callFunction's `t.pop().(float64)`),
+// then OP_CALL with the argument count.
+func TestRunFunctionCall(t *testing.T) {
+	// fn 0: double(x) = x + x
+	var fnCode []byte
+	fnCode = op(fnCode, opStoreName, 0) // store the one arg under names[0] ("x")
+	fnCode = op(fnCode, opLoadName, 0)
+	fnCode = op(fnCode, opLoadName, 0)
+	fnCode = op(fnCode, opAdd)
+	fnCode = op(fnCode, opRet)
+	fn := rawChunk{names: []string{"x"}, code: fnCode}
+
+	var mainCode []byte
+	mainCode = op(mainCode, opConstF64, 0) // push arg: 21
+	mainCode = op(mainCode, opConstF64, 1) // push callee id: 0
+	mainCode = op(mainCode, opCall, 1)
+	mainCode = op(mainCode, opRet)
+	main := rawChunk{floats: []float64{21, 0}, code: mainCode}
+
+	vm := New(buildModule([]rawChunk{fn}, main))
+
+	got := vm.Run()
+	if got != 42.0 {
+		t.Fatalf("Run() = %v, want 42.0", got)
+	}
+}
+
+// TestRunSpawnAndChannelRendezvous exercises OP_SPAWN, OP_CHAN_MAKE,
+// OP_CHAN_SEND, and OP_CHAN_RECV together: main spawns a worker and blocks
+// receiving on a channel before the worker has run, forcing the scheduler
+// to park main (parkRecv) and later requeue it once the worker's send
+// (trySend) wakes it -- the handoff drainUnparked exists to drive.
+func TestRunSpawnAndChannelRendezvous(t *testing.T) {
+	// fn 0 (worker): takes the channel as its only arg, sends 42 on it.
+	var workerCode []byte
+	workerCode = op(workerCode, opStoreName, 0) // store channel arg under names[0] ("ch")
+	workerCode = op(workerCode, opConstF64, 0)  // value to send: 42
+	workerCode = op(workerCode, opLoadName, 0)  // push channel
+	workerCode = op(workerCode, opChanSend)
+	workerCode = op(workerCode, opConstF64, 1) // dummy return value
+	workerCode = op(workerCode, opRet)
+	worker := rawChunk{floats: []float64{42, 0}, names: []string{"ch"}, code: workerCode}
+
+	var mainCode []byte
+	mainCode = op(mainCode, opChanMake, 1)  // capacity 1
+	mainCode = op(mainCode, opStoreName, 0) // store under names[0] ("ch")
+	mainCode = op(mainCode, opLoadName, 0)  // push channel (spawn arg)
+	mainCode = op(mainCode, opConstF64, 0)  // push callee id: 0 (worker)
+	mainCode = op(mainCode, opSpawn, 1)
+	mainCode = op(mainCode, opPop)         // discard the spawned thread's id
+	mainCode = op(mainCode, opLoadName, 0) // push channel (for recv)
+	mainCode = op(mainCode, opChanRecv)
+	mainCode = op(mainCode, opRet)
+	main := rawChunk{floats: []float64{0}, names: []string{"ch"}, code: mainCode}
+
+	vm := New(buildModule([]rawChunk{worker}, main))
+
+	got := vm.Run()
+	if got != 42.0 {
+		t.Fatalf("Run() = %v, want 42.0 received from the spawned worker", got)
+	}
+}
+
+// TestRunDeadlockOnUnmatchedRecv exercises deadlockMessage/runScheduler's
+// panic path: a single thread blocks receiving on a channel nothing will
+// ever send on, so the queue empties with it still parked.
+func TestRunDeadlockOnUnmatchedRecv(t *testing.T) {
+	var mainCode []byte
+	mainCode = op(mainCode, opChanMake, 1)
+	mainCode = op(mainCode, opChanRecv)
+	mainCode = op(mainCode, opRet)
+	main := rawChunk{code: mainCode}
+
+	vm := New(buildModule(nil, main))
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("Run() did not panic, want a deadlock panic")
+		}
+		msg, ok := r.(string)
+		if !ok || !containsDeadlock(msg) {
+			t.Errorf("panic = %v, want a message mentioning the deadlocked thread", r)
+		}
+	}()
+	vm.Run()
+}
+
+func containsDeadlock(msg string) bool {
+	return len(msg) > 0 && bytes.Contains([]byte(msg), []byte("deadlock"))
+}
@@ -0,0 +1,72 @@
+package kvm
+
+import "fmt"
+
+// runScheduler drives every runnable Thread to completion (or deadlock),
+// round-robin, each getting up to quantum instructions per turn before
+// being requeued. It's the concurrent analogue of the old single-threaded
+// Run loop: Thread.step is what Run used to be, scoped to one thread's
+// state instead of the VM's.
+func (vm *VM) runScheduler(main *Thread) interface{} {
+	queue := []*Thread{main}
+
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+
+		if t.state == threadBlocked {
+			// A thread can be requeued by the channel that unblocked it
+			// (trySend/tryRecv flip state back to threadRunnable)
+			// before the scheduler gets back around to it; anything
+			// still blocked here just waits for that to happen and is
+			// not re-added to the queue until then.
+			vm.parked = append(vm.parked, t)
+			continue
+		}
+
+		t.step(vm)
+
+		switch t.state {
+		case threadDone:
+			// Nothing to requeue.
+		case threadBlocked:
+			vm.parked = append(vm.parked, t)
+		default:
+			queue = append(queue, t)
+		}
+
+		vm.drainUnparked(&queue)
+
+		if len(queue) == 0 && len(vm.parked) > 0 {
+			panic(vm.deadlockMessage())
+		}
+	}
+
+	return main.result
+}
+
+// drainUnparked moves any previously-parked thread that a channel
+// operation has since marked runnable back onto the scheduler queue.
+func (vm *VM) drainUnparked(queue *[]*Thread) {
+	remaining := vm.parked[:0]
+	for _, t := range vm.parked {
+		if t.state == threadRunnable {
+			*queue = append(*queue, t)
+		} else {
+			remaining = append(remaining, t)
+		}
+	}
+	vm.parked = remaining
+}
+
+// deadlockMessage lists every still-blocked thread's id and ip, so a
+// caller can at least see where each thread stalled even though the KBC
+// format doesn't yet map an ip back to a source location (see
+// VM.RunSafe).
+func (vm *VM) deadlockMessage() string {
+	msg := "deadlock: all threads are blocked on channel operations:"
+	for _, t := range vm.parked {
+		msg += fmt.Sprintf("\n  thread %d blocked at ip=%d", t.id, t.ip)
+	}
+	return msg
+}
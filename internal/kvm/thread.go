@@ -0,0 +1,94 @@
+package kvm
+
+import "encoding/binary"
+
+// threadState tracks where a Thread sits in the scheduler.
+type threadState int
+
+const (
+	threadRunnable threadState = iota
+	threadBlocked
+	threadDone
+)
+
+// quantum bounds how many instructions a single Thread.step call executes
+// before being requeued, so one thread can't starve the others.
+const quantum = 1024
+
+// Thread is one green thread: its own instruction pointer, stack, and
+// call stack, executing against a shared VM's host functions, deadline,
+// and op budget. Before green threads, VM itself held exactly this state
+// for a single implicit thread; Run() now always runs at least a main
+// Thread through the scheduler.
+type Thread struct {
+	id int
+
+	ip    int
+	sp    int
+	stack []interface{}
+
+	callStack []Frame
+	code      []byte
+
+	// ints/floats/strings/names are the typed constant pools for the
+	// chunk currently executing (main or, after a call, the callee),
+	// swapped in callFunction/returnFromFunction along with the rest of
+	// Frame. vars holds this chunk's OP_LOAD_NAME/OP_STORE_NAME storage,
+	// keyed by name rather than by a shared slot index.
+	ints    []int64
+	floats  []float64
+	strings []string
+	names   []string
+	vars    map[string]interface{}
+
+	state     threadState
+	blockedOn *Channel
+
+	// result holds the value returned (via OP_RET with an empty
+	// callStack) once state == threadDone, used by the main thread to
+	// report VM.Run's return value.
+	result interface{}
+}
+
+func newThread(id int, code []byte, ints []int64, floats []float64, strings []string, names []string) *Thread {
+	return &Thread{
+		id:        id,
+		stack:     make([]interface{}, 0, 64),
+		callStack: []Frame{},
+		code:      code,
+		ints:      ints,
+		floats:    floats,
+		strings:   strings,
+		names:     names,
+		vars:      map[string]interface{}{},
+		state:     threadRunnable,
+	}
+}
+
+func (t *Thread) push(v interface{}) {
+	t.stack = append(t.stack, v)
+	t.sp++
+}
+
+func (t *Thread) pop() interface{} {
+	if t.sp == 0 {
+		panic("Stack underflow")
+	}
+	t.sp--
+	v := t.stack[t.sp]
+	t.stack = t.stack[:t.sp]
+	return v
+}
+
+func (t *Thread) peek() interface{} {
+	if t.sp == 0 {
+		panic("Stack empty")
+	}
+	return t.stack[t.sp-1]
+}
+
+func (t *Thread) readInt() int {
+	v := int(binary.LittleEndian.Uint32(t.code[t.ip:]))
+	t.ip += 4
+	return v
+}
@@ -0,0 +1,52 @@
+package lexer
+
+import "fmt"
+
+// Position locates a single point in a source file, analogous to Go's
+// scanner.Position: File is the name the lexer was constructed with,
+// Offset is the byte (rune) index from the start of the source, and
+// Line/Column are 1-based.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+	Offset int
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Diagnostic is a single lexer error, e.g. an unterminated string or a
+// mismatched dedent.
+type Diagnostic struct {
+	Pos Position
+	Msg string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Msg)
+}
+
+// ErrorList accumulates Diagnostics in the order they were raised.
+type ErrorList []Diagnostic
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].String()
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+	}
+}
+
+// ErrorHandler is called once per Diagnostic as it's raised, in addition
+// to it being appended to the Lexer's own ErrorList -- mirroring Go's
+// scanner.ErrorHandler, for callers (like an LSP) that want errors
+// reported as they're found rather than batched at the end.
+type ErrorHandler func(pos Position, msg string)
@@ -1,6 +1,13 @@
 package lexer
 
-import "unicode"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"kyra/internal/diag"
+)
 
 // TokenType describes the kind of token.
 type TokenType string
@@ -14,14 +21,34 @@ const (
 	DEDENT  TokenType = "DEDENT"
 
 	// Identifiers + literals
-	IDENT  TokenType = "IDENT"
-	NUMBER TokenType = "NUMBER"
+	IDENT TokenType = "IDENT"
 	STRING TokenType = "STRING"
 
+	// INT and FLOAT are produced by lexNumber in place of the old untyped
+	// NUMBER: INT for decimal/hex/octal/binary integer literals (with an
+	// optional i32/i64 suffix), FLOAT for anything with a '.' or exponent
+	// (with an optional f32/f64 suffix). Each carries its parsed value in
+	// the Token's IntValue/FloatValue field.
+	INT   TokenType = "INT"
+	FLOAT TokenType = "FLOAT"
+
+	// NUMBER is unused by lexNumber now (superseded by INT/FLOAT) but
+	// left defined for any external tooling still matching on it.
+	NUMBER TokenType = "NUMBER"
+
+	// f-string interpolation: f"a {b} c" lexes as FSTRING_BEGIN,
+	// STRING_CHUNK("a "), then the normal token stream for `b`, then
+	// STRING_CHUNK(" c"), FSTRING_END -- with one STRING_CHUNK emitted
+	// per literal run, even if empty (e.g. back-to-back "{a}{b}").
+	FSTRING_BEGIN TokenType = "FSTRING_BEGIN"
+	STRING_CHUNK  TokenType = "STRING_CHUNK"
+	FSTRING_END   TokenType = "FSTRING_END"
+
 	// Keywords
 	K_DEF    TokenType = "DEF"
 	K_FUNC   TokenType = "FUNC"
 	K_USE    TokenType = "USE"
+	K_MACRO  TokenType = "MACRO"
 	K_LET    TokenType = "LET"
 	K_IF     TokenType = "IF"
 	K_ELSE   TokenType = "ELSE"
@@ -78,10 +105,25 @@ const (
 
 // Token represents a single lexical token.
 type Token struct {
-	Type    TokenType
-	Lexeme  string
-	Line    int
-	Column  int
+	Type   TokenType
+	Lexeme string
+	Line   int
+	Column int
+
+	// Span is the token's byte-offset range into the source, used to
+	// annotate diagnostics raised downstream in the parser and VM.
+	Span diag.Span
+
+	// Pos is the token's start Position, File/Line/Column/Offset, in the
+	// style of Go's scanner.Position.
+	Pos Position
+
+	// IntValue and FloatValue hold the already-parsed value of an INT or
+	// FLOAT token respectively (the one matching Type is meaningful, the
+	// other is zero); Lexeme still carries the original source text,
+	// suffix included, for error messages and round-tripping.
+	IntValue   int64
+	FloatValue float64
 }
 
 // Lexer converts source text into tokens.
@@ -91,26 +133,111 @@ type Lexer struct {
 	line        int
 	col         int
 	indentStack []int
+
+	// indentChar records which whitespace character built each
+	// indentStack level (' ', '\t', or 0 for the base level / a blank
+	// line that didn't establish one), so a sibling line reaching the
+	// same column count via a different character can be rejected even
+	// though the two are consistent on their own -- see lexIndentation.
+	indentChar  []byte
 	startOfLine bool
+
+	// file identifies this lexer's source within a diag.Files registry so
+	// emitted tokens carry a Span usable by diagnostics.
+	file     diag.FileID
+	filename string
+
+	// handler, if set, is called once per Diagnostic as it's raised, in
+	// addition to it being appended to errs. Lexing continues afterward
+	// rather than stopping or emitting a malformed token.
+	handler ErrorHandler
+	errs    ErrorList
+
+	// pending holds tokens already produced but not yet returned -- used
+	// by lexFString to splice a nested token stream in between the
+	// chunks it lexes itself, and by lexIndentation to emit more than
+	// one DEDENT from a single dedenting line.
+	pending []Token
+
+	// brackets counts unmatched '(', '[', '{' currently open; while
+	// positive, NEWLINE/INDENT/DEDENT are suppressed so multi-line
+	// expressions and argument lists don't need explicit continuations.
+	brackets int
+
+	// peekBuf holds tokens produced for Peek but not yet consumed by
+	// Next -- a lookahead ring separate from pending, which is the
+	// lexer's own internal queue (DEDENTs, f-string pieces).
+	peekBuf []Token
 }
 
-// New creates a new lexer for the given source.
+// New creates a new lexer for the given source, tagged as file 0. Use
+// NewFile when lexing a source that has been registered with a
+// diag.Files registry under a different id.
 func New(src string) *Lexer {
+	return NewFile(0, "", src)
+}
+
+// NewFile creates a new lexer for src, tagging every token's Span with
+// the given file id and name. Use SetErrorHandler to be notified of
+// Diagnostics as they're raised, instead of only via Errors() once
+// lexing finishes.
+func NewFile(file diag.FileID, name, src string) *Lexer {
 	return &Lexer{
 		src:         []rune(src),
 		line:        1,
 		col:         0,
 		indentStack: []int{0},
+		indentChar:  []byte{0},
 		startOfLine: true,
+		file:        file,
+		filename:    name,
+	}
+}
+
+// SetErrorHandler installs handler to be called as each Diagnostic is
+// raised during lexing.
+func (l *Lexer) SetErrorHandler(handler ErrorHandler) {
+	l.handler = handler
+}
+
+// Errors returns every Diagnostic raised so far. The lexer never stops
+// at the first bad token -- callers should check len(l.Errors()) > 0
+// after Lex() rather than trust that the token stream is well-formed.
+func (l *Lexer) Errors() ErrorList {
+	return l.errs
+}
+
+// span builds a diag.Span covering [start, l.pos) in this lexer's file.
+func (l *Lexer) span(start int) diag.Span {
+	return diag.Span{FileID: l.file, Start: start, End: l.pos}
+}
+
+// startPosition builds the Position of the rune at offset start, for a
+// token whose content began there.
+func (l *Lexer) startPosition(start int) Position {
+	return Position{File: l.filename, Line: l.line, Column: l.col - (l.pos - start), Offset: start}
+}
+
+// errorf raises a Diagnostic at the lexer's current position: it's
+// appended to errs, and also forwarded to handler if one was installed,
+// mirroring Go's scanner.ErrorHandler.
+func (l *Lexer) errorf(pos Position, format string, args ...interface{}) {
+	d := Diagnostic{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	l.errs = append(l.errs, d)
+	if l.handler != nil {
+		l.handler(d.Pos, d.Msg)
 	}
 }
 
-// Lex tokenizes the entire input and returns a token slice.
+// Lex tokenizes the entire input and returns a token slice. It's a thin
+// wrapper over Next -- prefer Next/Peek directly for large sources or
+// incremental tooling (an LSP, a REPL) that shouldn't hold every token
+// in memory at once.
 func (l *Lexer) Lex() []Token {
 	var tokens []Token
 
 	for {
-		tok := l.nextToken()
+		tok := l.Next()
 		tokens = append(tokens, tok)
 		if tok.Type == EOF {
 			break
@@ -120,43 +247,168 @@ func (l *Lexer) Lex() []Token {
 	return tokens
 }
 
+// Next returns the next token in the stream, consuming it -- the
+// primitive every other public entry point (Lex, Peek) is built on.
+func (l *Lexer) Next() Token {
+	if len(l.peekBuf) > 0 {
+		tok := l.peekBuf[0]
+		l.peekBuf = l.peekBuf[1:]
+		return tok
+	}
+	return l.nextToken()
+}
+
+// Peek returns the token n positions ahead (Peek(0) is what the next
+// Next() call will return) without consuming it, buffering whatever it
+// had to lex along the way in a small ring so repeated lookahead at the
+// same depth doesn't re-lex anything.
+func (l *Lexer) Peek(n int) Token {
+	for len(l.peekBuf) <= n {
+		l.peekBuf = append(l.peekBuf, l.nextToken())
+	}
+	return l.peekBuf[n]
+}
+
+// Checkpoint captures everything Reset needs to rewind a Lexer to
+// exactly this point in the stream, letting a parser try a speculative
+// alternative (e.g. disambiguating a func expression from a one-liner)
+// without re-lexing from the start of the source.
+type Checkpoint struct {
+	pos         int
+	line        int
+	col         int
+	indentStack []int
+	indentChar  []byte
+	startOfLine bool
+	brackets    int
+	pending     []Token
+	peekBuf     []Token
+	errCount    int
+}
+
+// Mark snapshots the lexer's current scanning state.
+func (l *Lexer) Mark() Checkpoint {
+	return Checkpoint{
+		pos:         l.pos,
+		line:        l.line,
+		col:         l.col,
+		indentStack: append([]int(nil), l.indentStack...),
+		indentChar:  append([]byte(nil), l.indentChar...),
+		startOfLine: l.startOfLine,
+		brackets:    l.brackets,
+		pending:     append([]Token(nil), l.pending...),
+		peekBuf:     append([]Token(nil), l.peekBuf...),
+		errCount:    len(l.errs),
+	}
+}
+
+// Reset rewinds the lexer to a Checkpoint from an earlier Mark call,
+// also discarding any Diagnostic raised since -- a speculative parse
+// that backtracks shouldn't leave errors behind for an alternative that
+// goes on to succeed.
+func (l *Lexer) Reset(cp Checkpoint) {
+	l.pos = cp.pos
+	l.line = cp.line
+	l.col = cp.col
+	l.indentStack = append([]int(nil), cp.indentStack...)
+	l.indentChar = append([]byte(nil), cp.indentChar...)
+	l.startOfLine = cp.startOfLine
+	l.brackets = cp.brackets
+	l.pending = append([]Token(nil), cp.pending...)
+	l.peekBuf = append([]Token(nil), cp.peekBuf...)
+	if cp.errCount < len(l.errs) {
+		l.errs = l.errs[:cp.errCount]
+	}
+}
+
 func (l *Lexer) nextToken() Token {
-	// Handle indentation only at the start of a line
-	if l.startOfLine {
+	if len(l.pending) > 0 {
+		tok := l.pending[0]
+		l.pending = l.pending[1:]
+		return tok
+	}
+	return l.scanToken()
+}
+
+// scanToken lexes the next token directly from source, never consulting
+// l.pending -- unlike nextToken, which drains l.pending first. This is
+// the primitive lexFStringExpr must use: it needs to lex fresh tokens for
+// an interpolation's {expr}, not whatever an enclosing f-string already
+// queued on l.pending waiting to be drained by the *caller* of nextToken.
+func (l *Lexer) scanToken() Token {
+	// Handle indentation only at the start of a line, and only outside
+	// any unmatched bracket (a continuation line inside a (), [], or {}
+	// doesn't start a new logical line).
+	if l.startOfLine && l.brackets == 0 {
 		l.startOfLine = false
 		return l.lexIndentation()
 	}
+	l.startOfLine = false
 
 	l.skipWhitespaceExceptNewline()
 
 	if l.isAtEnd() {
-		// Emit DEDENTs for any remaining indentation
 		if len(l.indentStack) > 1 {
-			l.indentStack = l.indentStack[:len(l.indentStack)-1]
-			return Token{Type: DEDENT, Lexeme: "", Line: l.line, Column: l.col}
+			return l.emitRemainingDedents()
 		}
-		return Token{Type: EOF, Lexeme: "", Line: l.line, Column: l.col}
+		return Token{Type: EOF, Lexeme: "", Line: l.line, Column: l.col, Span: l.span(l.pos), Pos: l.startPosition(l.pos)}
 	}
 
 	ch := l.peek()
 
-	// Newline
+	// Explicit line continuation: a trailing '\' right before '\n'
+	// swallows the newline instead of ending the logical line.
+	if ch == '\\' && l.peekNext() == '\n' {
+		l.advance()
+		l.advance()
+		l.line++
+		l.col = 0
+		return l.scanToken()
+	}
+
+	// Newline, suppressed inside unmatched brackets so multi-line
+	// expressions and argument lists don't need '\' continuations.
 	if ch == '\n' {
+		start := l.pos
 		l.advance()
 		l.line++
 		l.col = 0
+		if l.brackets > 0 {
+			return l.scanToken()
+		}
 		l.startOfLine = true
-		return Token{Type: NEWLINE, Lexeme: "\n", Line: l.line - 1, Column: 0}
+		return Token{Type: NEWLINE, Lexeme: "\n", Line: l.line - 1, Column: 0, Span: l.span(start), Pos: l.startPosition(start)}
 	}
 
 	// Comments
 	if ch == '#' {
 		l.skipLineComment()
-		return l.nextToken()
+		return l.scanToken()
 	}
 	if ch == '/' && l.peekNext() == '*' {
 		l.skipBlockComment()
-		return l.nextToken()
+		return l.scanToken()
+	}
+
+	// f-string: an 'f' directly followed by a quote, e.g. f"{x}". A
+	// plain identifier named "f" is never followed immediately by a
+	// quote with no operator or whitespace between them, so this can't
+	// misfire on real identifiers. lexFString queues everything but its
+	// own leading FSTRING_BEGIN on l.pending and returns that token
+	// directly, rather than queuing it too and recursing back through
+	// nextToken to fetch it -- doing so would risk popping whatever an
+	// enclosing f-string had already queued instead.
+	if ch == 'f' && (l.peekNext() == '"' || l.peekNext() == '\'') {
+		return l.lexFString()
+	}
+
+	// Macro parameter placeholder: `$name`, e.g. inside a `macro` body.
+	// Lexed as a single IDENT token whose Lexeme keeps the leading '$'
+	// ("$name"), which is exactly what internal/parser/macro.go's
+	// substituteExpr already checks for to tell a template parameter
+	// apart from a free reference to an outer-scope name.
+	if ch == '$' && (isLetter(l.peekNext()) || l.peekNext() == '_') {
+		return l.lexMacroParam()
 	}
 
 	// Identifiers / keywords
@@ -169,7 +421,7 @@ func (l *Lexer) nextToken() Token {
 		return l.lexNumber()
 	}
 
-	// Strings: "..." , '...' , """..."""
+	// Strings: "..." , '...' , """...""" , `...` (raw, no escapes)
 	if ch == '"' {
 		// Check for multiline """
 		if l.peekNext() == '"' && l.peekThird() == '"' {
@@ -180,6 +432,9 @@ func (l *Lexer) nextToken() Token {
 	if ch == '\'' {
 		return l.lexString('\'')
 	}
+	if ch == '`' {
+		return l.lexRawString()
+	}
 
 	// Operators and delimiters
 	return l.lexSymbol()
@@ -256,21 +511,29 @@ func (l *Lexer) skipBlockComment() {
 }
 
 func (l *Lexer) lexIndentation() Token {
-	// Count spaces at the start of the line
+	// Count leading whitespace; tabs count as 4 spaces, but a line
+	// mixing tabs and spaces in its indentation is rejected outright
+	// rather than silently normalized, since the effective column a tab
+	// represents is editor-dependent.
 	count := 0
+	sawSpace, sawTab := false, false
 	for !l.isAtEnd() {
 		ch := l.peek()
 		if ch == ' ' {
+			sawSpace = true
 			count++
 			l.advance()
 		} else if ch == '\t' {
-			// Tabs are treated as 4 spaces here
+			sawTab = true
 			count += 4
 			l.advance()
 		} else {
 			break
 		}
 	}
+	if sawSpace && sawTab {
+		l.errorf(l.startPosition(l.pos), "inconsistent use of tabs and spaces in indentation")
+	}
 
 	// Blank line or comment line
 	if l.isAtEnd() || l.peek() == '\n' || l.peek() == '#' ||
@@ -279,21 +542,89 @@ func (l *Lexer) lexIndentation() Token {
 		return l.nextToken()
 	}
 
+	// lineChar is this line's single indent character, or 0 if the line
+	// used neither (count == 0) -- the sawSpace && sawTab case above
+	// already covers a line mixing both itself.
+	var lineChar byte
+	switch {
+	case sawTab:
+		lineChar = '\t'
+	case sawSpace:
+		lineChar = ' '
+	}
+
 	currentIndent := l.indentStack[len(l.indentStack)-1]
 	if count > currentIndent {
 		l.indentStack = append(l.indentStack, count)
-		return Token{Type: INDENT, Lexeme: "", Line: l.line, Column: 0}
+		l.indentChar = append(l.indentChar, lineChar)
+		return Token{Type: INDENT, Lexeme: "", Line: l.line, Column: 0, Span: l.span(l.pos), Pos: l.startPosition(l.pos)}
 	}
 	if count < currentIndent {
-		// Pop until we match or underflow
-		l.indentStack = l.indentStack[:len(l.indentStack)-1]
-		return Token{Type: DEDENT, Lexeme: "", Line: l.line, Column: 0}
+		var dedents []Token
+		for len(l.indentStack) > 1 && count < l.indentStack[len(l.indentStack)-1] {
+			l.indentStack = l.indentStack[:len(l.indentStack)-1]
+			l.indentChar = l.indentChar[:len(l.indentChar)-1]
+			dedents = append(dedents, Token{Type: DEDENT, Lexeme: "", Line: l.line, Column: 0, Span: l.span(l.pos), Pos: l.startPosition(l.pos)})
+		}
+		if l.indentStack[len(l.indentStack)-1] != count {
+			l.errorf(l.startPosition(l.pos), "mismatched dedent: indentation %d does not match any enclosing level", count)
+		} else {
+			l.checkIndentChar(count, lineChar)
+		}
+		l.pending = append(l.pending, dedents[1:]...)
+		return dedents[0]
 	}
 
-	// Same indentation: just continue
+	// Same indentation as the current level: still a sibling line, so it
+	// must agree on which character built that level.
+	l.checkIndentChar(count, lineChar)
 	return l.nextToken()
 }
 
+// checkIndentChar flags a line whose indentation reaches count via a
+// different whitespace character than the one that originally
+// established the stack level already at count -- e.g. one sibling
+// indented with a tab (4 cols) and another with 4 spaces. Both lines are
+// internally consistent (lexIndentation's sawSpace && sawTab check
+// already rejects a single line mixing the two), so this is the only
+// place that catches the cross-line case; a level no line has indented
+// to yet (char 0) or a dedent back to the top level (char both 0) never
+// triggers it.
+func (l *Lexer) checkIndentChar(count int, lineChar byte) {
+	levelChar := l.indentChar[len(l.indentChar)-1]
+	if levelChar != 0 && lineChar != 0 && levelChar != lineChar {
+		l.errorf(l.startPosition(l.pos), "inconsistent use of tabs and spaces: this line indents with %q, but an earlier line at the same level used %q", lineChar, levelChar)
+	}
+}
+
+// emitRemainingDedents pops every indent level still open at end of
+// input, queuing one DEDENT per level on l.pending.
+func (l *Lexer) emitRemainingDedents() Token {
+	var dedents []Token
+	for len(l.indentStack) > 1 {
+		l.indentStack = l.indentStack[:len(l.indentStack)-1]
+		l.indentChar = l.indentChar[:len(l.indentChar)-1]
+		dedents = append(dedents, Token{Type: DEDENT, Lexeme: "", Line: l.line, Column: l.col, Span: l.span(l.pos), Pos: l.startPosition(l.pos)})
+	}
+	l.pending = append(l.pending, dedents[1:]...)
+	return dedents[0]
+}
+
+// lexMacroParam scans a `$name` placeholder, starting at the '$' itself.
+// Unlike lexIdentifierOrKeyword, the result is never a keyword -- a
+// template parameter named e.g. $if would otherwise shadow nothing
+// sensible, so no keyword lookup is attempted here.
+func (l *Lexer) lexMacroParam() Token {
+	startCol := l.col
+	startPos := l.pos
+	l.advance() // consume '$'
+	for !l.isAtEnd() && (isLetter(l.peek()) || isDigit(l.peek()) || l.peek() == '_') {
+		l.advance()
+	}
+	lex := string(l.src[startPos:l.pos])
+	return Token{Type: IDENT, Lexeme: lex, Line: l.line, Column: startCol, Span: l.span(startPos), Pos: l.startPosition(startPos)}
+}
+
 func (l *Lexer) lexIdentifierOrKeyword() Token {
 	startCol := l.col
 	startPos := l.pos
@@ -302,125 +633,489 @@ func (l *Lexer) lexIdentifierOrKeyword() Token {
 	}
 	lex := string(l.src[startPos:l.pos])
 
+	typ := IDENT
 	switch lex {
 	case "def":
-		return Token{Type: K_DEF, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_DEF
 	case "func":
-		return Token{Type: K_FUNC, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_FUNC
 	case "use":
-		return Token{Type: K_USE, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_USE
+	case "macro":
+		typ = K_MACRO
 	case "let":
-		return Token{Type: K_LET, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_LET
 	case "if":
-		return Token{Type: K_IF, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_IF
 	case "else":
-		return Token{Type: K_ELSE, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_ELSE
 	case "while":
-		return Token{Type: K_WHILE, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_WHILE
 	case "for":
-		return Token{Type: K_FOR, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_FOR
 	case "return":
-		return Token{Type: K_RETURN, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_RETURN
 	case "exit":
-		return Token{Type: K_EXIT, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_EXIT
 	case "pass":
-		return Token{Type: K_PASS, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_PASS
 	case "true":
-		return Token{Type: K_TRUE, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_TRUE
 	case "false":
-		return Token{Type: K_FALSE, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_FALSE
 	case "i32":
-		return Token{Type: K_I32, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_I32
 	case "i64":
-		return Token{Type: K_I64, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_I64
 	case "f32":
-		return Token{Type: K_F32, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_F32
 	case "f64":
-		return Token{Type: K_F64, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_F64
 	case "bool":
-		return Token{Type: K_BOOL, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_BOOL
 	case "string":
-		return Token{Type: K_STRING, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_STRING
 	case "void":
-		return Token{Type: K_VOID, Lexeme: lex, Line: l.line, Column: startCol}
-	default:
-		return Token{Type: IDENT, Lexeme: lex, Line: l.line, Column: startCol}
+		typ = K_VOID
 	}
+
+	return Token{Type: typ, Lexeme: lex, Line: l.line, Column: startCol, Span: l.span(startPos), Pos: l.startPosition(startPos)}
 }
 
+// lexNumber scans an integer or float literal: decimal, or 0x/0o/0b
+// prefixed (hex literals also allow a '.' and a 'p'/'P' binary exponent,
+// decimal literals allow an 'e'/'E' exponent), with '_' digit separators
+// throughout and an optional i32/i64/f32/f64 type suffix. It returns an
+// INT or FLOAT token with the parsed value already attached.
 func (l *Lexer) lexNumber() Token {
 	startCol := l.col
 	startPos := l.pos
-	hasDot := false
+	isFloat := false
 
+	if l.peek() == '0' && (l.peekNext() == 'x' || l.peekNext() == 'X') {
+		l.advance()
+		l.advance()
+		l.consumeDigits(isHexDigit)
+		if l.peek() == '.' && isHexDigit(l.peekNext()) {
+			isFloat = true
+			l.advance()
+			l.consumeDigits(isHexDigit)
+		}
+		if l.peek() == 'p' || l.peek() == 'P' {
+			isFloat = true
+			l.advance()
+			if l.peek() == '+' || l.peek() == '-' {
+				l.advance()
+			}
+			l.consumeDigits(isDigit)
+		}
+	} else if l.peek() == '0' && (l.peekNext() == 'o' || l.peekNext() == 'O') {
+		l.advance()
+		l.advance()
+		l.consumeDigits(isOctDigit)
+	} else if l.peek() == '0' && (l.peekNext() == 'b' || l.peekNext() == 'B') {
+		l.advance()
+		l.advance()
+		l.consumeDigits(isBinDigit)
+	} else {
+		l.consumeDigits(isDigit)
+		if l.peek() == '.' && isDigit(l.peekNext()) {
+			isFloat = true
+			l.advance()
+			l.consumeDigits(isDigit)
+		}
+		if l.peek() == 'e' || l.peek() == 'E' {
+			isFloat = true
+			l.advance()
+			if l.peek() == '+' || l.peek() == '-' {
+				l.advance()
+			}
+			l.consumeDigits(isDigit)
+		}
+	}
+
+	digits := string(l.src[startPos:l.pos])
+
+	switch {
+	case l.matchSuffix("i32"), l.matchSuffix("i64"):
+		if isFloat {
+			l.errorf(l.startPosition(startPos), "integer suffix on non-integral literal %q", digits)
+		}
+	case l.matchSuffix("f32"), l.matchSuffix("f64"):
+		isFloat = true
+	}
+
+	lex := string(l.src[startPos:l.pos])
+	clean := strings.ReplaceAll(digits, "_", "")
+	tok := Token{Line: l.line, Column: startCol, Lexeme: lex, Span: l.span(startPos), Pos: l.startPosition(startPos)}
+
+	if isFloat {
+		tok.Type = FLOAT
+		v, err := strconv.ParseFloat(clean, 64)
+		if err != nil {
+			l.errorf(tok.Pos, "invalid float literal %q", lex)
+		}
+		tok.FloatValue = v
+	} else {
+		tok.Type = INT
+		v, err := strconv.ParseInt(clean, 0, 64)
+		if err != nil {
+			l.errorf(tok.Pos, "invalid integer literal %q", lex)
+		}
+		tok.IntValue = v
+	}
+
+	return tok
+}
+
+// consumeDigits advances over a run of characters matching isDigitFn,
+// also allowing '_' separators so long as a matching digit follows (so a
+// trailing or doubled underscore isn't silently absorbed into the
+// literal).
+func (l *Lexer) consumeDigits(isDigitFn func(rune) bool) {
 	for !l.isAtEnd() {
 		ch := l.peek()
-		if isDigit(ch) {
+		if isDigitFn(ch) {
 			l.advance()
-		} else if ch == '.' && !hasDot {
-			hasDot = true
+		} else if ch == '_' && isDigitFn(l.peekNext()) {
 			l.advance()
 		} else {
 			break
 		}
 	}
+}
 
-	lex := string(l.src[startPos:l.pos])
-	return Token{Type: NUMBER, Lexeme: lex, Line: l.line, Column: startCol}
+// matchSuffix consumes s (e.g. "i64") if it appears next in the source
+// and isn't itself the start of a longer identifier (so "1i64x" lexes as
+// the identifier-ish remainder failing elsewhere, not a silently
+// truncated suffix).
+func (l *Lexer) matchSuffix(s string) bool {
+	end := l.pos + len(s)
+	if end > len(l.src) {
+		return false
+	}
+	if string(l.src[l.pos:end]) != s {
+		return false
+	}
+	if end < len(l.src) && (isLetter(l.src[end]) || isDigit(l.src[end])) {
+		return false
+	}
+	for range s {
+		l.advance()
+	}
+	return true
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func isOctDigit(ch rune) bool {
+	return ch >= '0' && ch <= '7'
+}
+
+func isBinDigit(ch rune) bool {
+	return ch == '0' || ch == '1'
 }
 
 func (l *Lexer) lexString(quote rune) Token {
 	startCol := l.col
+	tokStart := l.pos
 	l.advance() // consume opening quote
-	startPos := l.pos
 
+	var value strings.Builder
 	for !l.isAtEnd() && l.peek() != quote {
+		if l.peek() == '\\' {
+			value.WriteString(l.decodeEscape(tokStart))
+			continue
+		}
 		ch := l.advance()
 		if ch == '\n' {
 			l.line++
 			l.col = 0
 		}
+		value.WriteRune(ch)
 	}
-	lex := string(l.src[startPos:l.pos])
 
 	if !l.isAtEnd() {
 		l.advance() // closing quote
+	} else {
+		l.errorf(l.startPosition(tokStart), "unterminated string literal")
 	}
 
-	return Token{Type: STRING, Lexeme: lex, Line: l.line, Column: startCol}
+	return Token{Type: STRING, Lexeme: value.String(), Line: l.line, Column: startCol, Span: l.span(tokStart), Pos: l.startPosition(tokStart)}
 }
 
 func (l *Lexer) lexTripleString() Token {
 	startCol := l.col
+	tokStart := l.pos
 	// consume """
 	l.advance()
 	l.advance()
 	l.advance()
-	startPos := l.pos
 
+	var value strings.Builder
 	for !l.isAtEnd() {
 		if l.peek() == '"' && l.peekNext() == '"' && l.peekThird() == '"' {
 			break
 		}
+		if l.peek() == '\\' {
+			value.WriteString(l.decodeEscape(tokStart))
+			continue
+		}
 		ch := l.advance()
 		if ch == '\n' {
 			l.line++
 			l.col = 0
 		}
+		value.WriteRune(ch)
 	}
-	lex := string(l.src[startPos:l.pos])
 
 	if !l.isAtEnd() {
 		// consume closing """
 		l.advance()
 		l.advance()
 		l.advance()
+	} else {
+		l.errorf(l.startPosition(tokStart), "unterminated triple-quoted string literal")
+	}
+
+	return Token{Type: STRING, Lexeme: value.String(), Line: l.line, Column: startCol, Span: l.span(tokStart), Pos: l.startPosition(tokStart)}
+}
+
+// lexRawString scans a backtick-delimited literal verbatim -- no escape
+// processing, so it's the natural way to write a literal containing
+// backslashes (regexes, Windows paths) without doubling them up.
+func (l *Lexer) lexRawString() Token {
+	startCol := l.col
+	tokStart := l.pos
+	l.advance() // consume opening backtick
+	startPos := l.pos
+
+	for !l.isAtEnd() && l.peek() != '`' {
+		ch := l.advance()
+		if ch == '\n' {
+			l.line++
+			l.col = 0
+		}
+	}
+	lex := string(l.src[startPos:l.pos])
+
+	if !l.isAtEnd() {
+		l.advance() // closing backtick
+	} else {
+		l.errorf(l.startPosition(tokStart), "unterminated raw string literal")
 	}
 
-	return Token{Type: STRING, Lexeme: lex, Line: l.line, Column: startCol}
+	return Token{Type: STRING, Lexeme: lex, Line: l.line, Column: startCol, Span: l.span(tokStart), Pos: l.startPosition(tokStart)}
+}
+
+// lexFString scans an f-string literal (f"..." or f'...') into a flat
+// token stream rather than a single Token: FSTRING_BEGIN, then one
+// STRING_CHUNK per literal run (decoded the same as a regular string,
+// including {{ and }} as escaped braces), with each {expr} lexed by
+// recursively calling scanToken -- so an interpolation can itself
+// contain strings, numbers, or even a nested f-string -- tracking brace
+// depth so a literal '{'/'}' produced by a nested macro or call doesn't
+// end the interpolation early. Terminated by FSTRING_END. FSTRING_BEGIN
+// is returned directly; the rest are queued on l.pending for subsequent
+// nextToken() calls to drain.
+func (l *Lexer) lexFString() Token {
+	startCol := l.col
+	tokStart := l.pos
+	l.advance() // consume 'f'
+	quote := l.advance()
+
+	begin := Token{Type: FSTRING_BEGIN, Lexeme: "f" + string(quote), Line: l.line, Column: startCol, Span: l.span(tokStart), Pos: l.startPosition(tokStart)}
+
+	var chunk strings.Builder
+	chunkStart := l.pos
+	flushChunk := func() {
+		l.pending = append(l.pending, Token{Type: STRING_CHUNK, Lexeme: chunk.String(), Line: l.line, Column: l.col, Span: l.span(chunkStart), Pos: l.startPosition(chunkStart)})
+		chunk.Reset()
+	}
+
+scan:
+	for {
+		if l.isAtEnd() {
+			l.errorf(l.startPosition(tokStart), "unterminated f-string literal")
+			flushChunk()
+			break
+		}
+
+		switch {
+		case l.peek() == quote:
+			flushChunk()
+			l.advance()
+			break scan
+
+		case l.peek() == '{' && l.peekNext() == '{':
+			chunk.WriteRune('{')
+			l.advance()
+			l.advance()
+
+		case l.peek() == '}' && l.peekNext() == '}':
+			chunk.WriteRune('}')
+			l.advance()
+			l.advance()
+
+		case l.peek() == '{':
+			flushChunk()
+			l.advance() // consume '{'
+			l.lexFStringExpr()
+			chunkStart = l.pos
+
+		case l.peek() == '\\':
+			chunk.WriteString(l.decodeEscape(tokStart))
+
+		default:
+			ch := l.advance()
+			if ch == '\n' {
+				l.line++
+				l.col = 0
+			}
+			chunk.WriteRune(ch)
+		}
+	}
+
+	l.pending = append(l.pending, Token{Type: FSTRING_END, Lexeme: string(quote), Line: l.line, Column: l.col, Span: l.span(l.pos), Pos: l.startPosition(l.pos)})
+	return begin
+}
+
+// lexFStringExpr lexes the normal token stream making up one {expr}
+// interpolation, queuing every token except the closing '}' onto
+// l.pending, tracking brace depth so a '{'/'}' produced inside the
+// expression itself (e.g. a macro body) doesn't terminate it early. It
+// fetches each token via scanToken, not nextToken: the enclosing
+// lexFString call has already queued earlier chunks on l.pending waiting
+// to be drained by nextToken's *caller*, so going through nextToken here
+// would pop those instead of lexing the interpolation's own fresh
+// tokens -- the queued tokens would never satisfy the LBRACE/RBRACE/EOF
+// checks below, so they'd just get appended right back, looping forever.
+func (l *Lexer) lexFStringExpr() {
+	depth := 1
+	for {
+		// A nested f-string (or a multi-DEDENT line) queues its trailing
+		// tokens on l.pending before returning its first one, so tok goes
+		// back in ahead of whatever this scanToken call queued.
+		mark := len(l.pending)
+		tok := l.scanToken()
+		if tok.Type == EOF {
+			l.errorf(tok.Pos, "unterminated f-string interpolation")
+			return
+		}
+		if tok.Type == LBRACE {
+			depth++
+		} else if tok.Type == RBRACE {
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+		l.pending = append(l.pending, Token{})
+		copy(l.pending[mark+1:], l.pending[mark:])
+		l.pending[mark] = tok
+	}
+}
+
+// decodeEscape consumes a backslash escape sequence (the leading '\\'
+// has not yet been consumed) and returns its decoded text. litStart
+// anchors diagnostics to the start of the enclosing literal, matching
+// the other lex* error sites.
+func (l *Lexer) decodeEscape(litStart int) string {
+	l.advance() // consume '\\'
+	if l.isAtEnd() {
+		l.errorf(l.startPosition(litStart), "unterminated escape sequence")
+		return ""
+	}
+
+	esc := l.advance()
+	switch esc {
+	case 'a':
+		return "\a"
+	case 'b':
+		return "\b"
+	case 'f':
+		return "\f"
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case 'v':
+		return "\v"
+	case '\\':
+		return "\\"
+	case '\'':
+		return "'"
+	case '"':
+		return "\""
+	case 'x':
+		return l.decodeHexEscape(litStart, 2)
+	case 'u':
+		return l.decodeHexEscape(litStart, 4)
+	case 'U':
+		return l.decodeHexEscape(litStart, 8)
+	default:
+		if esc >= '0' && esc <= '7' {
+			digits := []rune{esc}
+			for len(digits) < 3 && isOctDigit(l.peek()) {
+				digits = append(digits, l.advance())
+			}
+			v, err := strconv.ParseInt(string(digits), 8, 32)
+			if err != nil {
+				l.errorf(l.startPosition(litStart), "invalid escape sequence '\\%s'", string(digits))
+				return ""
+			}
+			return string(rune(v))
+		}
+		l.errorf(l.startPosition(litStart), "invalid escape sequence '\\%c'", esc)
+		return string(esc)
+	}
+}
+
+// decodeHexEscape consumes exactly n hex digits after \x, \u, or \U and
+// returns the decoded rune as a string.
+func (l *Lexer) decodeHexEscape(litStart int, n int) string {
+	start := l.pos
+	for i := 0; i < n; i++ {
+		if !isHexDigit(l.peek()) {
+			l.errorf(l.startPosition(litStart), "invalid escape sequence: expected %d hex digits", n)
+			return string(l.src[start:l.pos])
+		}
+		l.advance()
+	}
+	v, err := strconv.ParseInt(string(l.src[start:l.pos]), 16, 32)
+	if err != nil {
+		l.errorf(l.startPosition(litStart), "invalid escape sequence")
+		return ""
+	}
+	return string(rune(v))
 }
 
 func (l *Lexer) lexSymbol() Token {
+	tokStart := l.pos
+	tok := l.lexSymbolRaw()
+	tok.Span = l.span(tokStart)
+	tok.Pos = l.startPosition(tokStart)
+	if tok.Type == ILLEGAL {
+		l.errorf(tok.Pos, "unexpected character %q", tok.Lexeme)
+	}
+
+	switch tok.Type {
+	case LPAREN, LBRACKET, LBRACE:
+		l.brackets++
+	case RPAREN, RBRACKET, RBRACE:
+		if l.brackets > 0 {
+			l.brackets--
+		}
+	}
+
+	return tok
+}
+
+func (l *Lexer) lexSymbolRaw() Token {
 	ch := l.advance()
 	startCol := l.col - 1
 
@@ -0,0 +1,293 @@
+package lexer
+
+import "testing"
+
+func TestNextConsumesInOrder(t *testing.T) {
+	l := New("a b c")
+	var got []string
+	for {
+		tok := l.Next()
+		if tok.Type == EOF {
+			break
+		}
+		got = append(got, tok.Lexeme)
+	}
+	want := []string{"a", "b", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("token %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPeekDoesNotConsume(t *testing.T) {
+	l := New("a b")
+	if got := l.Peek(0); got.Lexeme != "a" {
+		t.Fatalf("Peek(0) = %q, want %q", got.Lexeme, "a")
+	}
+	if got := l.Peek(0); got.Lexeme != "a" {
+		t.Fatalf("second Peek(0) = %q, want %q (peek must not advance)", got.Lexeme, "a")
+	}
+	if got := l.Next(); got.Lexeme != "a" {
+		t.Fatalf("Next() after Peek(0) = %q, want %q", got.Lexeme, "a")
+	}
+}
+
+func TestPeekAheadMatchesSubsequentNext(t *testing.T) {
+	l := New("a b c")
+	if got := l.Peek(2); got.Lexeme != "c" {
+		t.Fatalf("Peek(2) = %q, want %q", got.Lexeme, "c")
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		if got := l.Next(); got.Lexeme != want {
+			t.Fatalf("Next() = %q, want %q", got.Lexeme, want)
+		}
+	}
+}
+
+func TestMarkResetRewindsStream(t *testing.T) {
+	l := New("a b c")
+	if got := l.Next(); got.Lexeme != "a" {
+		t.Fatalf("Next() = %q, want %q", got.Lexeme, "a")
+	}
+
+	cp := l.Mark()
+	if got := l.Next(); got.Lexeme != "b" {
+		t.Fatalf("Next() = %q, want %q", got.Lexeme, "b")
+	}
+	if got := l.Next(); got.Lexeme != "c" {
+		t.Fatalf("Next() = %q, want %q", got.Lexeme, "c")
+	}
+
+	l.Reset(cp)
+	if got := l.Next(); got.Lexeme != "b" {
+		t.Fatalf("Next() after Reset = %q, want %q", got.Lexeme, "b")
+	}
+	if got := l.Next(); got.Lexeme != "c" {
+		t.Fatalf("Next() after Reset = %q, want %q", got.Lexeme, "c")
+	}
+}
+
+func TestMarkResetDiscardsErrorsRaisedAfter(t *testing.T) {
+	l := New("a\n    b\n\tc\n")
+	cp := l.Mark()
+	for {
+		tok := l.Next()
+		if tok.Type == EOF {
+			break
+		}
+	}
+	if len(l.Errors()) == 0 {
+		t.Fatal("expected the mixed-indent source to raise an error before reset")
+	}
+
+	l.Reset(cp)
+	if len(l.Errors()) != 0 {
+		t.Fatalf("Errors() after Reset = %v, want none", l.Errors())
+	}
+}
+
+// TestIllegalCharacterIsReportedAsDiagnostic covers chunk1-1: an unexpected
+// character is recorded as a Diagnostic on Errors() (rather than only
+// surfacing as an ILLEGAL token the parser has to notice on its own).
+func TestIllegalCharacterIsReportedAsDiagnostic(t *testing.T) {
+	l := New("a @ b")
+	for {
+		tok := l.Next()
+		if tok.Type == EOF {
+			break
+		}
+	}
+	if len(l.Errors()) != 1 {
+		t.Fatalf("Errors() = %v, want exactly one diagnostic for '@'", l.Errors())
+	}
+}
+
+// TestUnterminatedStringIsReportedAsDiagnostic covers chunk1-1's other
+// error path: a string that never finds its closing quote.
+func TestUnterminatedStringIsReportedAsDiagnostic(t *testing.T) {
+	l := New(`"unterminated`)
+	l.Next()
+	if len(l.Errors()) != 1 {
+		t.Fatalf("Errors() = %v, want exactly one diagnostic for the unterminated string", l.Errors())
+	}
+}
+
+// TestLexNumberRadixSeparatorsAndSuffixes covers chunk1-2: radix prefixes,
+// '_' separators, exponents, and i32/i64/f32/f64 suffixes all parse into
+// the right Token.Type and IntValue/FloatValue.
+func TestLexNumberRadixSeparatorsAndSuffixes(t *testing.T) {
+	tests := []struct {
+		src       string
+		wantType  TokenType
+		wantInt   int64
+		wantFloat float64
+	}{
+		{"0x1F", INT, 0x1F, 0},
+		{"0o17", INT, 15, 0},
+		{"0b101", INT, 5, 0},
+		{"1_000_000", INT, 1000000, 0},
+		{"1_000i64", INT, 1000, 0},
+		{"3.5", FLOAT, 0, 3.5},
+		{"1e3", FLOAT, 0, 1000},
+		{"2.5f32", FLOAT, 0, 2.5},
+	}
+	for _, tt := range tests {
+		l := New(tt.src)
+		tok := l.Next()
+		if tok.Type != tt.wantType {
+			t.Errorf("lex(%q).Type = %v, want %v", tt.src, tok.Type, tt.wantType)
+			continue
+		}
+		if tt.wantType == INT && tok.IntValue != tt.wantInt {
+			t.Errorf("lex(%q).IntValue = %d, want %d", tt.src, tok.IntValue, tt.wantInt)
+		}
+		if tt.wantType == FLOAT && tok.FloatValue != tt.wantFloat {
+			t.Errorf("lex(%q).FloatValue = %g, want %g", tt.src, tok.FloatValue, tt.wantFloat)
+		}
+	}
+}
+
+// TestLexNumberRejectsIntegerSuffixOnFloat covers the fix for the bug where
+// an integer suffix on a non-integral mantissa (e.g. "3.5i32") silently
+// lexed as a FLOAT with the suffix discarded and no error raised.
+func TestLexNumberRejectsIntegerSuffixOnFloat(t *testing.T) {
+	l := New("3.5i32")
+	tok := l.Next()
+	if tok.Type != FLOAT || tok.FloatValue != 3.5 {
+		t.Fatalf("lex(%q) = %v (%v), want FLOAT 3.5", "3.5i32", tok.Type, tok.FloatValue)
+	}
+	if len(l.Errors()) != 1 {
+		t.Fatalf("Errors() = %v, want exactly one diagnostic for the integer suffix on a non-integral literal", l.Errors())
+	}
+}
+
+// TestLexStringDecodesEscapes covers chunk1-3: backslash escapes in a
+// regular string literal are decoded, not copied through raw.
+func TestLexStringDecodesEscapes(t *testing.T) {
+	l := New(`"a\tb\n\"c\""`)
+	tok := l.Next()
+	want := "a\tb\n\"c\""
+	if tok.Type != STRING || tok.Lexeme != want {
+		t.Fatalf("lex = %v %q, want STRING %q", tok.Type, tok.Lexeme, want)
+	}
+}
+
+// TestLexRawStringSkipsEscapeProcessing covers chunk1-3's backtick raw
+// string form: backslashes pass through untouched.
+func TestLexRawStringSkipsEscapeProcessing(t *testing.T) {
+	l := New("`a\\tb`")
+	tok := l.Next()
+	if tok.Type != STRING || tok.Lexeme != `a\tb` {
+		t.Fatalf("lex = %v %q, want STRING %q", tok.Type, tok.Lexeme, `a\tb`)
+	}
+}
+
+// TestLexFStringInterpolatesExpressions covers chunk1-3's f-string form: a
+// flat FSTRING_BEGIN/STRING_CHUNK/.../FSTRING_END stream with the
+// interpolated expression's own tokens spliced in between chunks.
+func TestLexFStringInterpolatesExpressions(t *testing.T) {
+	l := New(`f"a{b}c"`)
+	var types []TokenType
+	for {
+		tok := l.Next()
+		if tok.Type == EOF {
+			break
+		}
+		types = append(types, tok.Type)
+	}
+	want := []TokenType{FSTRING_BEGIN, STRING_CHUNK, IDENT, STRING_CHUNK, FSTRING_END}
+	if len(types) != len(want) {
+		t.Fatalf("token types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("token %d = %v, want %v", i, types[i], want[i])
+		}
+	}
+}
+
+// TestLexIndentationEmitsMultipleDedents covers chunk1-4: dedenting
+// straight back to the top level from two nested indents queues one DEDENT
+// per level, not just one.
+func TestLexIndentationEmitsMultipleDedents(t *testing.T) {
+	l := New("a\n    b\n        c\nd\n")
+	var types []TokenType
+	for {
+		tok := l.Next()
+		if tok.Type == EOF {
+			break
+		}
+		types = append(types, tok.Type)
+	}
+	want := []TokenType{
+		IDENT, NEWLINE,
+		INDENT, IDENT, NEWLINE,
+		INDENT, IDENT, NEWLINE,
+		DEDENT, DEDENT, IDENT, NEWLINE,
+	}
+	if len(types) != len(want) {
+		t.Fatalf("token types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("token %d = %v, want %v", i, types[i], want[i])
+		}
+	}
+}
+
+// TestLexIndentationRejectsMixedTabsAndSpacesAcrossLines covers chunk1-4's
+// fix (17be22a) for cross-line mixed indentation: two sibling lines at the
+// same level that disagree on tabs vs. spaces must be flagged, not just a
+// single line mixing both itself.
+func TestLexIndentationRejectsMixedTabsAndSpacesAcrossLines(t *testing.T) {
+	l := New("a\n    b\n\tc\n")
+	for {
+		tok := l.Next()
+		if tok.Type == EOF {
+			break
+		}
+	}
+	if len(l.Errors()) == 0 {
+		t.Fatal("expected an error for sibling lines indenting with different whitespace characters")
+	}
+}
+
+// TestLexIndentationSuppressesNewlinesInsideBrackets covers chunk1-4's
+// bracket-depth tracking: a multi-line argument list inside unmatched
+// parens produces no NEWLINE/INDENT/DEDENT tokens until the brackets close.
+func TestLexIndentationSuppressesNewlinesInsideBrackets(t *testing.T) {
+	l := New("f(\n    a,\n    b,\n)\n")
+	var types []TokenType
+	for {
+		tok := l.Next()
+		if tok.Type == EOF {
+			break
+		}
+		types = append(types, tok.Type)
+	}
+	for _, typ := range types {
+		if typ == RPAREN {
+			break
+		}
+		if typ == NEWLINE || typ == INDENT || typ == DEDENT {
+			t.Fatalf("token types = %v, want no NEWLINE/INDENT/DEDENT while brackets are open", types)
+		}
+	}
+}
+
+func TestMarkResetWithPendingPeek(t *testing.T) {
+	l := New("a b c")
+	l.Peek(1) // buffers "a" and "b" into peekBuf without consuming either
+	cp := l.Mark()
+	l.Next()
+	l.Next()
+
+	l.Reset(cp)
+	if got := l.Next(); got.Lexeme != "a" {
+		t.Fatalf("Next() after Reset = %q, want %q", got.Lexeme, "a")
+	}
+}
@@ -0,0 +1,342 @@
+// Package optimize implements a peephole pass over an emitted
+// bytecode.Chunk. The emitter (internal/bytecode) favors simple,
+// uniform codegen over efficient codegen -- every NumberExpr becomes a
+// fresh OP_CONST_*, every ForStmt re-pushes its step constant every
+// iteration, and so on -- so Pass cleans up the handful of patterns
+// that show up the most:
+//
+//  1. Constant folding: adjacent "push const; push const; arithmetic
+//     op" triples are replaced by the single folded constant.
+//  2. "push the int 0; OP_STORE_NAME" is collapsed into OP_STORE_ZERO,
+//     which needs no constant operand at all.
+//  3. Jump threading: a JMP/JMPF/JMPT that targets another unconditional
+//     JMP is retargeted straight to that JMP's own target, so control
+//     flow doesn't bounce through an intermediate jump at runtime.
+//  4. Dead code elimination: instructions after an unconditional
+//     OP_RET/OP_EXIT are unreachable fall-through and are dropped, up to
+//     the next instruction something still jumps to.
+package optimize
+
+import (
+	"encoding/binary"
+
+	"kyra/internal/bytecode"
+)
+
+// instr is one decoded instruction: its opcode, its operands (each
+// originally a 4-byte little-endian int), and the byte offset it started
+// at in the Chunk.Code this pass is currently working from. origPos is
+// carried forward across transforms so jump targets (which are recorded
+// as original byte offsets) can be remapped to wherever the instruction
+// they pointed at ends up after folding/elimination.
+type instr struct {
+	op       byte
+	operands []int
+	origPos  int
+}
+
+// operandCount reports how many 4-byte int operands follow op in the
+// instruction stream. Kept local to this package rather than shared with
+// bytecode.disasm's own opsWithIntOperand/mnemonics tables, the same way
+// those two already duplicate opcode metadata rather than share it.
+func operandCount(op byte) int {
+	switch op {
+	case bytecode.OP_HOSTCALL:
+		return 2
+	case bytecode.OP_ADD, bytecode.OP_SUB, bytecode.OP_MUL, bytecode.OP_DIV, bytecode.OP_MOD,
+		bytecode.OP_EQ, bytecode.OP_NEQ, bytecode.OP_LT, bytecode.OP_GT, bytecode.OP_LE, bytecode.OP_GE,
+		bytecode.OP_AND, bytecode.OP_OR, bytecode.OP_NOT,
+		bytecode.OP_RET, bytecode.OP_POP, bytecode.OP_EXIT, bytecode.OP_YIELD,
+		bytecode.OP_CHAN_SEND, bytecode.OP_CHAN_RECV:
+		return 0
+	default:
+		return 1
+	}
+}
+
+func isJump(op byte) bool {
+	return op == bytecode.OP_JMP || op == bytecode.OP_JMPF || op == bytecode.OP_JMPT
+}
+
+// Pass optimizes c.Code in place. It's a no-op on an empty chunk.
+func Pass(c *bytecode.Chunk) {
+	orig := decode(c.Code)
+	if len(orig) == 0 {
+		return
+	}
+
+	threadJumps(orig)
+
+	targets := jumpTargets(orig)
+
+	folded := foldConstants(orig, c, targets)
+	folded = collapseStoreZero(folded, c, targets)
+	folded = eliminateDeadCode(folded, targets)
+
+	code, posMap := encode(folded)
+	retarget(code, folded, posMap)
+
+	c.Code = code
+}
+
+func decode(code []byte) []instr {
+	var out []instr
+	pc := 0
+	for pc < len(code) {
+		op := code[pc]
+		start := pc
+		pc++
+		n := operandCount(op)
+		operands := make([]int, n)
+		for i := 0; i < n; i++ {
+			operands[i] = int(binary.LittleEndian.Uint32(code[pc:]))
+			pc += 4
+		}
+		out = append(out, instr{op: op, operands: operands, origPos: start})
+	}
+	return out
+}
+
+// threadJumps rewrites every jump's target operand in place, following
+// chains of unconditional JMPs to their ultimate destination so later
+// stages (and the final retarget step) never have to re-discover the
+// chain. It only threads through OP_JMP, never through OP_JMPF/OP_JMPT,
+// since those pop a value and can't be skipped over transparently.
+func threadJumps(instrs []instr) {
+	byPos := make(map[int]*instr, len(instrs))
+	for i := range instrs {
+		byPos[instrs[i].origPos] = &instrs[i]
+	}
+
+	for i := range instrs {
+		in := &instrs[i]
+		if !isJump(in.op) {
+			continue
+		}
+
+		target := in.operands[0]
+		seen := map[int]bool{}
+		for {
+			next, ok := byPos[target]
+			if !ok || next.op != bytecode.OP_JMP || seen[target] {
+				break
+			}
+			seen[target] = true
+			target = next.operands[0]
+		}
+		in.operands[0] = target
+	}
+}
+
+// jumpTargets collects every byte offset a jump in instrs points to,
+// i.e. every position later stages must preserve as an instruction
+// boundary even if it would otherwise fold or get eliminated.
+func jumpTargets(instrs []instr) map[int]bool {
+	targets := map[int]bool{}
+	for _, in := range instrs {
+		if isJump(in.op) {
+			targets[in.operands[0]] = true
+		}
+	}
+	return targets
+}
+
+// foldConstants collapses "push const; push const; arithmetic op"
+// triples into a single folded push, as long as none of the three
+// instructions is itself a jump target (folding would erase the landing
+// instruction a jump still needs).
+func foldConstants(instrs []instr, c *bytecode.Chunk, targets map[int]bool) []instr {
+	var out []instr
+	for i := 0; i < len(instrs); i++ {
+		if i+2 < len(instrs) && isArith(instrs[i+2].op) {
+			a, aok := constValue(c, instrs[i])
+			b, bok := constValue(c, instrs[i+1])
+			if aok && bok && !targets[instrs[i].origPos] && !targets[instrs[i+1].origPos] && !targets[instrs[i+2].origPos] {
+				if folded, ok := foldPair(c, a, b, instrs[i+2].op); ok {
+					out = append(out, folded)
+					i += 2
+					continue
+				}
+			}
+		}
+		out = append(out, instrs[i])
+	}
+	return out
+}
+
+func isArith(op byte) bool {
+	switch op {
+	case bytecode.OP_ADD, bytecode.OP_SUB, bytecode.OP_MUL, bytecode.OP_DIV:
+		return true
+	}
+	return false
+}
+
+// constOperand is a CONST_I64/CONST_F64 push resolved from the chunk's
+// pool back to its actual value, tagged with which pool it came from so
+// foldPair can pick the right result type.
+type constOperand struct {
+	isInt    bool
+	intVal   int64
+	floatVal float64
+}
+
+// constValue resolves in's pushed value via c's typed pools, reporting
+// whether in is a CONST_I64/CONST_F64 push at all; it doesn't resolve
+// CONST_STR since string operands aren't foldable by +/-/*//.
+func constValue(c *bytecode.Chunk, in instr) (constOperand, bool) {
+	switch in.op {
+	case bytecode.OP_CONST_I64:
+		return constOperand{isInt: true, intVal: c.Ints[in.operands[0]]}, true
+	case bytecode.OP_CONST_F64:
+		return constOperand{floatVal: c.Floats[in.operands[0]]}, true
+	}
+	return constOperand{}, false
+}
+
+// foldPair applies op to a and b at compile time, registering the
+// result in c's int or float pool (int arithmetic stays int and yields an
+// OP_CONST_I64; a float on either side promotes the result to float and
+// yields an OP_CONST_F64).
+func foldPair(c *bytecode.Chunk, a, b constOperand, op byte) (instr, bool) {
+	if a.isInt && b.isInt {
+		x, y := a.intVal, b.intVal
+		var v int64
+		switch op {
+		case bytecode.OP_ADD:
+			v = x + y
+		case bytecode.OP_SUB:
+			v = x - y
+		case bytecode.OP_MUL:
+			v = x * y
+		case bytecode.OP_DIV:
+			if y == 0 {
+				return instr{}, false
+			}
+			v = x / y
+		default:
+			return instr{}, false
+		}
+		return instr{op: bytecode.OP_CONST_I64, operands: []int{c.AddInt(v)}, origPos: -1}, true
+	}
+
+	x, y := asFloat(a), asFloat(b)
+	var v float64
+	switch op {
+	case bytecode.OP_ADD:
+		v = x + y
+	case bytecode.OP_SUB:
+		v = x - y
+	case bytecode.OP_MUL:
+		v = x * y
+	case bytecode.OP_DIV:
+		if y == 0 {
+			return instr{}, false
+		}
+		v = x / y
+	default:
+		return instr{}, false
+	}
+	return instr{op: bytecode.OP_CONST_F64, operands: []int{c.AddFloat(v)}, origPos: -1}, true
+}
+
+func asFloat(o constOperand) float64 {
+	if o.isInt {
+		return float64(o.intVal)
+	}
+	return o.floatVal
+}
+
+// collapseStoreZero rewrites "OP_CONST_I64 <index of the int 0>;
+// OP_STORE_NAME n" into a single "OP_STORE_ZERO n", as long as the
+// OP_STORE_NAME isn't itself a jump target (a jump landing there expects
+// the value already pushed). A jump to the CONST_I64 push is fine: the
+// collapsed instruction keeps that push's original offset.
+func collapseStoreZero(instrs []instr, c *bytecode.Chunk, targets map[int]bool) []instr {
+	var out []instr
+	for i := 0; i < len(instrs); i++ {
+		if i+1 < len(instrs) &&
+			instrs[i].op == bytecode.OP_CONST_I64 &&
+			instrs[i+1].op == bytecode.OP_STORE_NAME &&
+			!targets[instrs[i+1].origPos] &&
+			isZeroConst(c, instrs[i].operands[0]) {
+
+			out = append(out, instr{
+				op:       bytecode.OP_STORE_ZERO,
+				operands: []int{instrs[i+1].operands[0]},
+				origPos:  instrs[i].origPos,
+			})
+			i++
+			continue
+		}
+		out = append(out, instrs[i])
+	}
+	return out
+}
+
+func isZeroConst(c *bytecode.Chunk, idx int) bool {
+	return idx >= 0 && idx < len(c.Ints) && c.Ints[idx] == 0
+}
+
+// eliminateDeadCode drops every instruction immediately following an
+// unconditional OP_RET/OP_EXIT up to (not including) the next
+// instruction something still jumps to -- that one, and everything
+// after it, is reachable again.
+func eliminateDeadCode(instrs []instr, targets map[int]bool) []instr {
+	var out []instr
+	dead := false
+	for _, in := range instrs {
+		if dead && targets[in.origPos] {
+			dead = false
+		}
+		if dead {
+			continue
+		}
+		out = append(out, in)
+		if in.op == bytecode.OP_RET || in.op == bytecode.OP_EXIT {
+			dead = true
+		}
+	}
+	return out
+}
+
+// encode serializes instrs back to bytes, returning a map from every
+// surviving instruction's original byte offset to its new one so jump
+// operands (which were recorded as original offsets) can be retargeted
+// afterward. Synthetic instructions (origPos < 0, introduced by constant
+// folding) aren't jump targets in practice -- this compiler never jumps
+// into the middle of an expression -- so they don't need an entry.
+func encode(instrs []instr) ([]byte, map[int]int) {
+	var code []byte
+	posMap := make(map[int]int, len(instrs))
+
+	for _, in := range instrs {
+		if in.origPos >= 0 {
+			posMap[in.origPos] = len(code)
+		}
+		code = append(code, in.op)
+		for _, operand := range in.operands {
+			var buf [4]byte
+			binary.LittleEndian.PutUint32(buf[:], uint32(operand))
+			code = append(code, buf[:]...)
+		}
+	}
+
+	return code, posMap
+}
+
+// retarget patches every jump's operand in the final encoded code from
+// an original-offset target to the corresponding new-offset target.
+func retarget(code []byte, instrs []instr, posMap map[int]int) {
+	pc := 0
+	for _, in := range instrs {
+		pc++
+		if isJump(in.op) {
+			newTarget, ok := posMap[in.operands[0]]
+			if ok {
+				binary.LittleEndian.PutUint32(code[pc:], uint32(newTarget))
+			}
+		}
+		pc += 4 * len(in.operands)
+	}
+}
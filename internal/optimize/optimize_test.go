@@ -0,0 +1,128 @@
+package optimize
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"kyra/internal/bytecode"
+)
+
+// emit appends op followed by its int32 operands to c.Code.
+func emit(c *bytecode.Chunk, op byte, operands ...int) {
+	c.Code = append(c.Code, op)
+	for _, v := range operands {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(v))
+		c.Code = append(c.Code, buf[:]...)
+	}
+}
+
+func TestPassFoldsConstantArithmetic(t *testing.T) {
+	c := bytecode.NewChunk()
+	emit(c, bytecode.OP_CONST_I64, c.AddInt(2))
+	emit(c, bytecode.OP_CONST_I64, c.AddInt(3))
+	emit(c, bytecode.OP_ADD)
+	emit(c, bytecode.OP_RET)
+
+	Pass(c)
+
+	want := []byte{bytecode.OP_CONST_I64}
+	if len(c.Code) < 1 || c.Code[0] != want[0] {
+		t.Fatalf("Code[0] = %v, want OP_CONST_I64", c.Code)
+	}
+	idx := int(binary.LittleEndian.Uint32(c.Code[1:5]))
+	if c.Ints[idx] != 5 {
+		t.Errorf("folded constant = %d, want 5", c.Ints[idx])
+	}
+	if c.Code[5] != bytecode.OP_RET {
+		t.Errorf("expected OP_RET right after the folded constant, got %#x", c.Code[5])
+	}
+}
+
+func TestPassDoesNotFoldAcrossAJumpTarget(t *testing.T) {
+	c := bytecode.NewChunk()
+	// JMP straight to the second CONST_I64 (offset 10), which is also
+	// the middle of what would otherwise be a foldable
+	// "const; const; ADD" triple -- folding it away would erase the
+	// instruction the jump lands on.
+	emit(c, bytecode.OP_JMP, 10)
+	emit(c, bytecode.OP_CONST_I64, c.AddInt(2)) // offset 5
+	emit(c, bytecode.OP_CONST_I64, c.AddInt(3)) // offset 10 -- jump target
+	emit(c, bytecode.OP_ADD)
+	emit(c, bytecode.OP_RET)
+
+	Pass(c)
+
+	constCount := 0
+	for _, b := range c.Code {
+		if b == bytecode.OP_CONST_I64 {
+			constCount++
+		}
+	}
+	if constCount != 2 {
+		t.Errorf("got %d OP_CONST_I64 instructions, want 2 (fold must not fire across a jump target); Code = %v", constCount, c.Code)
+	}
+}
+
+func TestPassCollapsesStoreZero(t *testing.T) {
+	c := bytecode.NewChunk()
+	nameIdx := c.AddName("x")
+	emit(c, bytecode.OP_CONST_I64, c.AddInt(0))
+	emit(c, bytecode.OP_STORE_NAME, nameIdx)
+	emit(c, bytecode.OP_RET)
+
+	Pass(c)
+
+	if len(c.Code) == 0 || c.Code[0] != bytecode.OP_STORE_ZERO {
+		t.Fatalf("Code = %v, want it to start with OP_STORE_ZERO", c.Code)
+	}
+	got := int(binary.LittleEndian.Uint32(c.Code[1:5]))
+	if got != nameIdx {
+		t.Errorf("OP_STORE_ZERO operand = %d, want %d", got, nameIdx)
+	}
+}
+
+func TestPassThreadsJumpsThroughIntermediateJMP(t *testing.T) {
+	c := bytecode.NewChunk()
+	emit(c, bytecode.OP_JMP, 5)  // offset 0: jumps to the JMP at offset 5
+	emit(c, bytecode.OP_JMP, 10) // offset 5: jumps to RET at offset 10
+	emit(c, bytecode.OP_RET)     // offset 10
+
+	Pass(c)
+
+	target := int(binary.LittleEndian.Uint32(c.Code[1:5]))
+	if c.Code[target] != bytecode.OP_RET {
+		t.Errorf("threaded jump lands on %#x at %d, want OP_RET", c.Code[target], target)
+	}
+}
+
+func TestPassEliminatesDeadCodeAfterReturn(t *testing.T) {
+	c := bytecode.NewChunk()
+	emit(c, bytecode.OP_RET)
+	emit(c, bytecode.OP_CONST_I64, c.AddInt(99)) // unreachable
+
+	Pass(c)
+
+	if len(c.Code) != 1 || c.Code[0] != bytecode.OP_RET {
+		t.Errorf("Code = %v, want dead code after OP_RET dropped", c.Code)
+	}
+}
+
+func TestPassKeepsDeadCodeThatIsAJumpTarget(t *testing.T) {
+	c := bytecode.NewChunk()
+	emit(c, bytecode.OP_JMP, 6)                  // offset 0: jumps past the RET into the "dead" region
+	emit(c, bytecode.OP_RET)                     // offset 5
+	emit(c, bytecode.OP_CONST_I64, c.AddInt(99)) // offset 6 -- after OP_RET but a jump target, should survive
+
+	Pass(c)
+
+	foundConst := false
+	for _, b := range c.Code {
+		if b == bytecode.OP_CONST_I64 {
+			foundConst = true
+		}
+	}
+	if !foundConst {
+		t.Error("expected the jump-targeted OP_CONST_I64 after OP_RET to survive dead-code elimination")
+	}
+}
@@ -0,0 +1,195 @@
+package parser
+
+// AST is the root of a parsed module: its top-level statements in source
+// order, with any macro invocations already expanded by Parse.
+type AST struct {
+	TopLevel []Stmt
+}
+
+// Expr is implemented by every expression node produced by parseExpr and
+// its helpers in expr.go.
+type Expr interface{ exprNode() }
+
+// Stmt is implemented by every statement node produced by parseStmt.
+type Stmt interface{ stmtNode() }
+
+// ---------------------------
+// Expressions
+// ---------------------------
+
+// NumberExpr is an integer or floating-point literal; Value keeps the
+// original lexeme around for diagnostics, while IsInt picks which of
+// IntValue/FloatValue the emitter should read.
+type NumberExpr struct {
+	Value      string
+	IsInt      bool
+	IntValue   int64
+	FloatValue float64
+}
+
+// StringExpr is a plain string literal, or one STRING_CHUNK of a lowered
+// f-string (see parseFString).
+type StringExpr struct {
+	Value string
+}
+
+// BoolExpr is a `true`/`false` literal.
+type BoolExpr struct {
+	Value bool
+}
+
+// IdentExpr is a bare identifier reference.
+type IdentExpr struct {
+	Name string
+}
+
+// AssignExpr is `name = expr`, produced by parseAssignment.
+type AssignExpr struct {
+	Name string
+	Expr Expr
+}
+
+// UnaryExpr is a prefix `-` or `!` applied to Expr.
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
+// BinaryExpr is a two-operand infix expression built by parseExpr's
+// precedence climbing.
+type BinaryExpr struct {
+	Left  Expr
+	Op    string
+	Right Expr
+}
+
+// CallExpr is `callee(args...)`.
+type CallExpr struct {
+	Callee Expr
+	Args   []Expr
+}
+
+// MemberExpr is `object.name`.
+type MemberExpr struct {
+	Object Expr
+	Name   string
+}
+
+// ParenExpr wraps a parenthesized sub-expression, kept as its own node
+// (rather than unwrapped at parse time) so diagnostics and pretty-printing
+// can still see the original grouping.
+type ParenExpr struct {
+	Expr Expr
+}
+
+func (*NumberExpr) exprNode()      {}
+func (*StringExpr) exprNode()      {}
+func (*BoolExpr) exprNode()        {}
+func (*IdentExpr) exprNode()       {}
+func (*AssignExpr) exprNode()      {}
+func (*UnaryExpr) exprNode()       {}
+func (*BinaryExpr) exprNode()      {}
+func (*CallExpr) exprNode()        {}
+func (*MemberExpr) exprNode()      {}
+func (*ParenExpr) exprNode()       {}
+func (*MacroInvokeExpr) exprNode() {}
+
+// ---------------------------
+// Statements
+// ---------------------------
+
+// ExprStmt is an expression evaluated for its side effect; the emitter
+// pops the resulting value rather than leaving it on the stack.
+type ExprStmt struct {
+	Expr Expr
+}
+
+// LetStmt binds Expr's value to Name.
+type LetStmt struct {
+	Name string
+	Expr Expr
+}
+
+// ReturnStmt evaluates Value (nil for a bare `return`) and hands it back
+// to the caller.
+type ReturnStmt struct {
+	Value Expr
+}
+
+// ExitStmt halts the program immediately via OP_EXIT.
+type ExitStmt struct{}
+
+// PassStmt is a no-op placeholder, e.g. for an otherwise-empty block.
+type PassStmt struct{}
+
+// IfStmt is `if cond: <Then> else: <Else>`; Else is nil when there's no
+// else clause, and holds a single nested IfStmt for `else if`.
+type IfStmt struct {
+	Cond Expr
+	Then []Stmt
+	Else []Stmt
+}
+
+// WhileStmt is `while cond: <Body>`.
+type WhileStmt struct {
+	Cond Expr
+	Body []Stmt
+}
+
+// ForStmt is Kyra's only loop shorthand, `for i limit:`, counting VarName
+// from 0 up to (exclusive) Limit's value.
+type ForStmt struct {
+	VarName string
+	Limit   Expr
+	Body    []Stmt
+}
+
+// Param is one function parameter; Type is the lexeme of its declared
+// type, or "" when untyped.
+type Param struct {
+	Name string
+	Type string
+}
+
+// FuncDef is `func name(params): <indented body>`.
+type FuncDef struct {
+	Name       string
+	Params     []Param
+	ReturnType string
+	Body       []Stmt
+}
+
+// FuncExprDef is `func name(params) -> expr`, a named function whose
+// body is a single expression rather than a block.
+type FuncExprDef struct {
+	Name   string
+	Params []Param
+	Expr   Expr
+}
+
+// FuncOneLiner is `func name(params): expr` on a single line -- like
+// FuncDef, but the body never consumes an INDENT.
+type FuncOneLiner struct {
+	Name   string
+	Params []Param
+	Expr   Expr
+}
+
+// UseStmt is a `use module/path` declaration; see parseUse.
+type UseStmt struct {
+	Path     []string
+	IsStdlib bool
+}
+
+func (*ExprStmt) stmtNode()     {}
+func (*LetStmt) stmtNode()      {}
+func (*ReturnStmt) stmtNode()   {}
+func (*ExitStmt) stmtNode()     {}
+func (*PassStmt) stmtNode()     {}
+func (*IfStmt) stmtNode()       {}
+func (*WhileStmt) stmtNode()    {}
+func (*ForStmt) stmtNode()      {}
+func (*FuncDef) stmtNode()      {}
+func (*FuncExprDef) stmtNode()  {}
+func (*FuncOneLiner) stmtNode() {}
+func (*UseStmt) stmtNode()      {}
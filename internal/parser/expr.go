@@ -88,14 +88,21 @@ func parsePrefix(p *Parser) Expr {
 	case lexer.IDENT:
 		return parseIdentifierOrCallOrMember(p)
 
-	case lexer.NUMBER:
+	case lexer.INT:
 		p.next()
-		return &NumberExpr{Value: tok.Lexeme}
+		return &NumberExpr{Value: tok.Lexeme, IsInt: true, IntValue: tok.IntValue}
+
+	case lexer.FLOAT:
+		p.next()
+		return &NumberExpr{Value: tok.Lexeme, FloatValue: tok.FloatValue}
 
 	case lexer.STRING:
 		p.next()
 		return &StringExpr{Value: tok.Lexeme}
 
+	case lexer.FSTRING_BEGIN:
+		return parseFString(p)
+
 	case lexer.K_TRUE:
 		p.next()
 		return &BoolExpr{Value: true}
@@ -129,6 +136,15 @@ func parsePrefix(p *Parser) Expr {
 
 func parseIdentifierOrCallOrMember(p *Parser) Expr {
 	ident := p.expect(lexer.IDENT, "identifier").Lexeme
+
+	// name!(...) invokes a macro expanded at compile time, rather than a
+	// runtime call; it's parsed here since it shares the identifier lead-in
+	// with a normal call.
+	if p.peek().Type == lexer.BANG {
+		p.next()
+		return parseMacroInvoke(p, ident)
+	}
+
 	var expr Expr = &IdentExpr{Name: ident}
 
 	for {
@@ -179,6 +195,15 @@ func parseCall(p *Parser, callee Expr) Expr {
 // Assignment
 // ---------------------------
 
+// compoundAssignOps desugars "x += y" (and -=, *=, /=) to "x = x <op> y"
+// so the emitter only ever has to know about plain AssignExpr.
+var compoundAssignOps = map[lexer.TokenType]string{
+	lexer.PLUS_EQ:  "+",
+	lexer.MINUS_EQ: "-",
+	lexer.MUL_EQ:   "*",
+	lexer.DIV_EQ:   "/",
+}
+
 func parseAssignment(p *Parser, left Expr) Expr {
 	tok := p.next()
 
@@ -189,8 +214,42 @@ func parseAssignment(p *Parser, left Expr) Expr {
 
 	value := p.parseExpression()
 
+	if op, ok := compoundAssignOps[tok.Type]; ok {
+		value = &BinaryExpr{Left: &IdentExpr{Name: ident.Name}, Op: op, Right: value}
+	}
+
 	return &AssignExpr{
 		Name: ident.Name,
 		Expr: value,
 	}
 }
+
+// ---------------------------
+// f-strings
+// ---------------------------
+
+// parseFString lowers an f-string's token stream -- FSTRING_BEGIN, then
+// alternating STRING_CHUNK and interpolated expression tokens, ending in
+// FSTRING_END -- into a chain of '+' concatenations, so the bytecode
+// emitter needs no dedicated interpolation opcode.
+func parseFString(p *Parser) Expr {
+	p.next() // consume FSTRING_BEGIN
+
+	var parts []Expr
+	for {
+		chunk := p.next() // STRING_CHUNK
+		parts = append(parts, &StringExpr{Value: chunk.Lexeme})
+
+		if p.peek().Type == lexer.FSTRING_END {
+			p.next()
+			break
+		}
+		parts = append(parts, p.parseExpression())
+	}
+
+	expr := parts[0]
+	for _, part := range parts[1:] {
+		expr = &BinaryExpr{Left: expr, Op: "+", Right: part}
+	}
+	return expr
+}
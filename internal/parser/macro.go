@@ -0,0 +1,339 @@
+package parser
+
+import (
+	"fmt"
+
+	"kyra/internal/diag"
+	"kyra/internal/lexer"
+)
+
+// maxMacroExpansionDepth bounds fixed-point expansion of nested macro
+// invocations so a macro that (directly or transitively) invokes itself
+// doesn't hang the compiler; expansion that hits the cap is reported as a
+// Diagnostic rather than looping forever.
+const maxMacroExpansionDepth = 64
+
+// MacroDef is a `macro name(args) { body }` declaration. The body is
+// stored as a template: a sequence of statements that may reference the
+// parameters by name, later substituted positionally at expansion time.
+type MacroDef struct {
+	Name   string
+	Params []string
+	Body   []Stmt
+}
+
+// MacroInvokeExpr is produced by parseIdentifierOrCallOrMember when it
+// sees `name!(...)`. It is resolved and replaced by the expansion pass;
+// the bytecode emitter never sees one in a fully-expanded AST.
+type MacroInvokeExpr struct {
+	Name string
+	Args []Expr
+}
+
+// macroTable holds the macro definitions visible to a module, keyed by
+// the UseStmt.Path they were imported under (joined with "/"), plus the
+// macros declared locally under the empty key "".
+type macroTable map[string]map[string]*MacroDef
+
+func newMacroTable() macroTable {
+	return macroTable{"": map[string]*MacroDef{}}
+}
+
+func (t macroTable) define(modulePath string, def *MacroDef) {
+	if t[modulePath] == nil {
+		t[modulePath] = map[string]*MacroDef{}
+	}
+	t[modulePath][def.Name] = def
+}
+
+func (t macroTable) lookup(name string) (*MacroDef, bool) {
+	for _, defs := range t {
+		if def, ok := defs[name]; ok {
+			return def, true
+		}
+	}
+	return nil, false
+}
+
+// parseMacroDef parses a `macro name(args) { body }` declaration. It is
+// called alongside parseUse at module top level.
+func (p *Parser) parseMacroDef() *MacroDef {
+	p.expect(lexer.K_MACRO, "macro declaration")
+	name := p.expect(lexer.IDENT, "macro name").Lexeme
+
+	p.expect(lexer.LPAREN, "expected '(' after macro name")
+	params := []string{}
+	if p.peek().Type != lexer.RPAREN {
+		for {
+			params = append(params, p.expect(lexer.IDENT, "macro parameter").Lexeme)
+			if !p.match(lexer.COMMA) {
+				break
+			}
+		}
+	}
+	p.expect(lexer.RPAREN, "expected ')' after macro parameters")
+
+	p.expect(lexer.LBRACE, "expected '{' to start macro body")
+	body := []Stmt{}
+	for p.peek().Type != lexer.RBRACE && p.peek().Type != lexer.EOF {
+		body = append(body, p.parseStmt())
+	}
+	p.expect(lexer.RBRACE, "expected '}' to close macro body")
+
+	return &MacroDef{Name: name, Params: params, Body: body}
+}
+
+// parseMacroInvoke parses the argument list of `name!(...)` once the
+// leading identifier and '!' have already been consumed.
+func parseMacroInvoke(p *Parser, name string) Expr {
+	p.expect(lexer.LPAREN, "expected '(' after macro invocation")
+
+	args := []Expr{}
+	if p.peek().Type != lexer.RPAREN {
+		for {
+			args = append(args, p.parseExpression())
+			if !p.match(lexer.COMMA) {
+				break
+			}
+		}
+	}
+	p.expect(lexer.RPAREN, "expected ')' after macro arguments")
+
+	return &MacroInvokeExpr{Name: name, Args: args}
+}
+
+// gensymCounter backs gensym, the monotonic counter used to rename
+// locally-introduced identifiers inside an expanded macro body so they
+// can't collide with identifiers at the call site (hygiene).
+var gensymCounter int
+
+// gensym returns a fresh identifier derived from base, guaranteed unique
+// for the lifetime of the process, mirroring how Kirc's new_var names
+// compiler-introduced temporaries.
+func gensym(base string) string {
+	gensymCounter++
+	return fmt.Sprintf("%s$%d", base, gensymCounter)
+}
+
+// expandMacros walks stmts after Parse() returns, substituting every
+// MacroInvokeExpr with its macro body. $arg placeholders inside a macro
+// body are bound positionally to the call's arguments; any identifier the
+// macro body introduces itself (as opposed to referencing a $arg) is
+// renamed via gensym so two expansions of the same macro never collide.
+func expandMacros(table macroTable, stmts []Stmt) ([]Stmt, []diag.Diagnostic) {
+	var diags []diag.Diagnostic
+	out := make([]Stmt, len(stmts))
+	for i, stmt := range stmts {
+		out[i] = expandStmt(table, stmt, 0, &diags)
+	}
+	return out, diags
+}
+
+func expandStmt(table macroTable, stmt Stmt, depth int, diags *[]diag.Diagnostic) Stmt {
+	switch s := stmt.(type) {
+	case *ExprStmt:
+		s.Expr = expandExpr(table, s.Expr, depth, diags)
+		return s
+	case *LetStmt:
+		s.Expr = expandExpr(table, s.Expr, depth, diags)
+		return s
+	case *ReturnStmt:
+		s.Value = expandExpr(table, s.Value, depth, diags)
+		return s
+	case *IfStmt:
+		s.Cond = expandExpr(table, s.Cond, depth, diags)
+		s.Then = expandBlock(table, s.Then, depth, diags)
+		s.Else = expandBlock(table, s.Else, depth, diags)
+		return s
+	case *WhileStmt:
+		s.Cond = expandExpr(table, s.Cond, depth, diags)
+		s.Body = expandBlock(table, s.Body, depth, diags)
+		return s
+	default:
+		return stmt
+	}
+}
+
+func expandBlock(table macroTable, stmts []Stmt, depth int, diags *[]diag.Diagnostic) []Stmt {
+	for i, stmt := range stmts {
+		stmts[i] = expandStmt(table, stmt, depth, diags)
+	}
+	return stmts
+}
+
+func expandExpr(table macroTable, expr Expr, depth int, diags *[]diag.Diagnostic) Expr {
+	invoke, ok := expr.(*MacroInvokeExpr)
+	if !ok {
+		return expr
+	}
+
+	if depth >= maxMacroExpansionDepth {
+		*diags = append(*diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Message:  fmt.Sprintf("macro %q did not reach a fixed point after %d expansions", invoke.Name, maxMacroExpansionDepth),
+		})
+		return expr
+	}
+
+	def, ok := table.lookup(invoke.Name)
+	if !ok {
+		*diags = append(*diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Message:  fmt.Sprintf("use of undefined macro %q", invoke.Name),
+		})
+		return expr
+	}
+
+	bindings := map[string]Expr{}
+	for i, param := range def.Params {
+		if i < len(invoke.Args) {
+			bindings[param] = invoke.Args[i]
+		}
+	}
+
+	rename := map[string]string{}
+	locals := collectLocals(def.Body)
+	expanded := make([]Stmt, len(def.Body))
+	for i, stmt := range def.Body {
+		expanded[i] = substituteStmt(stmt, bindings, locals, rename)
+	}
+
+	// A macro body that itself invokes a macro expands again, fixed-point.
+	expanded = expandBlock(table, expanded, depth+1, diags)
+
+	if len(expanded) == 1 {
+		if es, ok := expanded[0].(*ExprStmt); ok {
+			return es.Expr
+		}
+	}
+
+	// Multi-statement bodies can't be substituted in expression position
+	// without a block-expression AST node; report that rather than
+	// silently dropping statements.
+	*diags = append(*diags, diag.Diagnostic{
+		Severity: diag.Error,
+		Message:  fmt.Sprintf("macro %q expands to multiple statements, which is not valid in expression position", invoke.Name),
+	})
+	return expr
+}
+
+// collectLocals scans a macro template's statements, including nested
+// If/While blocks (the same subset substituteStmt recurses into), for
+// the names it binds itself via `let`, so substituteExpr can tell a
+// template-local binding apart from a free reference to something
+// defined outside the macro (an outer-scope function like panic, a
+// global, another $param). Only those locally bound names are
+// hygienically renamed.
+func collectLocals(body []Stmt) map[string]bool {
+	locals := map[string]bool{}
+	collectLocalsInto(body, locals)
+	return locals
+}
+
+func collectLocalsInto(body []Stmt, locals map[string]bool) {
+	for _, stmt := range body {
+		switch s := stmt.(type) {
+		case *LetStmt:
+			locals[s.Name] = true
+		case *IfStmt:
+			collectLocalsInto(s.Then, locals)
+			collectLocalsInto(s.Else, locals)
+		case *WhileStmt:
+			collectLocalsInto(s.Body, locals)
+		}
+	}
+}
+
+// substituteStmt clones stmt, replacing $arg placeholders with bindings
+// and renaming references to names in locals (identifiers the template
+// itself binds via let) to a gensym'd name shared across this single
+// expansion via rename. Any other identifier -- a free reference to an
+// outer-scope function or global -- is left exactly as written. If/While
+// bodies are recursed into (mirroring expandStmt's own handling of
+// nested blocks) rather than passed through verbatim, so a macro whose
+// template contains a conditional or loop still gets its $params bound
+// and its own locals renamed.
+func substituteStmt(stmt Stmt, bindings map[string]Expr, locals map[string]bool, rename map[string]string) Stmt {
+	switch s := stmt.(type) {
+	case *ExprStmt:
+		return &ExprStmt{Expr: substituteExpr(s.Expr, bindings, locals, rename)}
+	case *LetStmt:
+		return &LetStmt{Name: renameIdent(s.Name, rename), Expr: substituteExpr(s.Expr, bindings, locals, rename)}
+	case *ReturnStmt:
+		return &ReturnStmt{Value: substituteExpr(s.Value, bindings, locals, rename)}
+	case *IfStmt:
+		return &IfStmt{
+			Cond: substituteExpr(s.Cond, bindings, locals, rename),
+			Then: substituteBlock(s.Then, bindings, locals, rename),
+			Else: substituteBlock(s.Else, bindings, locals, rename),
+		}
+	case *WhileStmt:
+		return &WhileStmt{
+			Cond: substituteExpr(s.Cond, bindings, locals, rename),
+			Body: substituteBlock(s.Body, bindings, locals, rename),
+		}
+	default:
+		return stmt
+	}
+}
+
+func substituteBlock(body []Stmt, bindings map[string]Expr, locals map[string]bool, rename map[string]string) []Stmt {
+	out := make([]Stmt, len(body))
+	for i, stmt := range body {
+		out[i] = substituteStmt(stmt, bindings, locals, rename)
+	}
+	return out
+}
+
+func substituteExpr(expr Expr, bindings map[string]Expr, locals map[string]bool, rename map[string]string) Expr {
+	switch e := expr.(type) {
+	case *IdentExpr:
+		if len(e.Name) > 0 && e.Name[0] == '$' {
+			if bound, ok := bindings[e.Name[1:]]; ok {
+				return bound
+			}
+		}
+		if locals[e.Name] {
+			return &IdentExpr{Name: renameIdent(e.Name, rename)}
+		}
+		return &IdentExpr{Name: e.Name}
+	case *BinaryExpr:
+		return &BinaryExpr{Left: substituteExpr(e.Left, bindings, locals, rename), Op: e.Op, Right: substituteExpr(e.Right, bindings, locals, rename)}
+	case *UnaryExpr:
+		return &UnaryExpr{Op: e.Op, Expr: substituteExpr(e.Expr, bindings, locals, rename)}
+	case *CallExpr:
+		args := make([]Expr, len(e.Args))
+		for i, a := range e.Args {
+			args[i] = substituteExpr(a, bindings, locals, rename)
+		}
+		return &CallExpr{Callee: substituteExpr(e.Callee, bindings, locals, rename), Args: args}
+	case *ParenExpr:
+		return &ParenExpr{Expr: substituteExpr(e.Expr, bindings, locals, rename)}
+	case *AssignExpr:
+		name := e.Name
+		if locals[name] {
+			name = renameIdent(name, rename)
+		}
+		return &AssignExpr{Name: name, Expr: substituteExpr(e.Expr, bindings, locals, rename)}
+	case *MacroInvokeExpr:
+		args := make([]Expr, len(e.Args))
+		for i, a := range e.Args {
+			args[i] = substituteExpr(a, bindings, locals, rename)
+		}
+		return &MacroInvokeExpr{Name: e.Name, Args: args}
+	default:
+		return expr
+	}
+}
+
+// renameIdent gensyms a locally-introduced name the first time it's seen
+// within one expansion, then returns the same gensym'd name for every
+// later reference so the renamed bindings still agree with each other.
+func renameIdent(name string, rename map[string]string) string {
+	if renamed, ok := rename[name]; ok {
+		return renamed
+	}
+	renamed := gensym(name)
+	rename[name] = renamed
+	return renamed
+}
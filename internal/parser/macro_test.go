@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"testing"
+
+	"kyra/internal/lexer"
+)
+
+func parseSource(t *testing.T, src string) *AST {
+	t.Helper()
+	l := lexer.New(src)
+	tokens := l.Lex()
+	if errs := l.Errors(); len(errs) > 0 {
+		t.Fatalf("lex errors: %v", errs)
+	}
+	p := New(tokens)
+	ast, diags := p.ParseSafe()
+	if len(diags) > 0 {
+		t.Fatalf("parse diagnostics: %v", diags)
+	}
+	return ast
+}
+
+// TestParameterizedMacroEndToEnd exercises a macro that uses its own
+// parameter (via $x) all the way from source text through lexing,
+// parsing, and expansion -- $ident must tokenize, and the bound
+// argument must be substituted in place of every $x reference.
+func TestParameterizedMacroEndToEnd(t *testing.T) {
+	ast := parseSource(t, "macro double(x) {\n    $x + $x\n}\ndouble!(5)\n")
+
+	if len(ast.TopLevel) != 1 {
+		t.Fatalf("TopLevel = %#v, want exactly one expanded statement", ast.TopLevel)
+	}
+
+	exprStmt, ok := ast.TopLevel[0].(*ExprStmt)
+	if !ok {
+		t.Fatalf("TopLevel[0] = %#v (%T), want *ExprStmt", ast.TopLevel[0], ast.TopLevel[0])
+	}
+
+	bin, ok := exprStmt.Expr.(*BinaryExpr)
+	if !ok {
+		t.Fatalf("expanded expr = %#v (%T), want *BinaryExpr", exprStmt.Expr, exprStmt.Expr)
+	}
+	if bin.Op != "+" {
+		t.Errorf("bin.Op = %q, want %q", bin.Op, "+")
+	}
+
+	left, ok := bin.Left.(*NumberExpr)
+	if !ok || !left.IsInt || left.IntValue != 5 {
+		t.Errorf("bin.Left = %#v, want the NumberExpr 5 substituted for $x", bin.Left)
+	}
+	right, ok := bin.Right.(*NumberExpr)
+	if !ok || !right.IsInt || right.IntValue != 5 {
+		t.Errorf("bin.Right = %#v, want the NumberExpr 5 substituted for $x", bin.Right)
+	}
+}
+
+// TestSubstituteStmtRecursesIntoIfAndWhile guards against substituteStmt
+// silently passing IfStmt/WhileStmt bodies through unsubstituted and
+// unrenamed, the way it did before collectLocalsInto/substituteBlock
+// were added to recurse into them (mirroring expandStmt's own handling
+// of nested blocks). Exercised directly against substituteStmt, since
+// the expansion pipeline currently only ever splices a macro body into
+// expression position and rejects anything that isn't exactly one
+// ExprStmt -- this isolates the hygiene/substitution logic itself from
+// that separate, pre-existing restriction.
+func TestSubstituteStmtRecursesIntoIfAndWhile(t *testing.T) {
+	body := []Stmt{
+		&IfStmt{
+			Cond: &IdentExpr{Name: "$cond"},
+			Then: []Stmt{
+				&LetStmt{Name: "tmp", Expr: &IdentExpr{Name: "$cond"}},
+				&ExprStmt{Expr: &CallExpr{Callee: &IdentExpr{Name: "panic"}, Args: []Expr{&IdentExpr{Name: "tmp"}}}},
+			},
+			Else: nil,
+		},
+		&WhileStmt{
+			Cond: &IdentExpr{Name: "$cond"},
+			Body: []Stmt{&LetStmt{Name: "tmp", Expr: &IdentExpr{Name: "$cond"}}},
+		},
+	}
+
+	bindings := map[string]Expr{"cond": &BoolExpr{Value: true}}
+	locals := collectLocals(body)
+	rename := map[string]string{}
+
+	expanded := make([]Stmt, len(body))
+	for i, stmt := range body {
+		expanded[i] = substituteStmt(stmt, bindings, locals, rename)
+	}
+
+	ifStmt, ok := expanded[0].(*IfStmt)
+	if !ok {
+		t.Fatalf("expanded[0] = %#v (%T), want *IfStmt", expanded[0], expanded[0])
+	}
+	if _, ok := ifStmt.Cond.(*BoolExpr); !ok {
+		t.Errorf("ifStmt.Cond = %#v, want $cond substituted with the bound BoolExpr", ifStmt.Cond)
+	}
+	if len(ifStmt.Then) != 2 {
+		t.Fatalf("ifStmt.Then = %#v, want 2 statements carried through", ifStmt.Then)
+	}
+
+	let, ok := ifStmt.Then[0].(*LetStmt)
+	if !ok {
+		t.Fatalf("ifStmt.Then[0] = %#v (%T), want *LetStmt", ifStmt.Then[0], ifStmt.Then[0])
+	}
+	if let.Name == "tmp" {
+		t.Error("let.Name was not hygienically renamed inside the If's Then block")
+	}
+	renamedTmp := let.Name
+
+	call, ok := ifStmt.Then[1].(*ExprStmt).Expr.(*CallExpr)
+	if !ok {
+		t.Fatalf("ifStmt.Then[1] is not a CallExpr: %#v", ifStmt.Then[1])
+	}
+	if callee, ok := call.Callee.(*IdentExpr); !ok || callee.Name != "panic" {
+		t.Errorf("call.Callee = %#v, want the free reference to panic left untouched", call.Callee)
+	}
+	arg, ok := call.Args[0].(*IdentExpr)
+	if !ok || arg.Name != renamedTmp {
+		t.Errorf("call.Args[0] = %#v, want the reference to tmp renamed consistently to %q", call.Args[0], renamedTmp)
+	}
+
+	whileStmt, ok := expanded[1].(*WhileStmt)
+	if !ok {
+		t.Fatalf("expanded[1] = %#v (%T), want *WhileStmt", expanded[1], expanded[1])
+	}
+	if _, ok := whileStmt.Cond.(*BoolExpr); !ok {
+		t.Errorf("whileStmt.Cond = %#v, want $cond substituted with the bound BoolExpr", whileStmt.Cond)
+	}
+	if wlet, ok := whileStmt.Body[0].(*LetStmt); !ok || wlet.Name != renamedTmp {
+		t.Errorf("whileStmt.Body[0] = %#v, want a let renamed consistently to %q inside the While body", whileStmt.Body[0], renamedTmp)
+	}
+}
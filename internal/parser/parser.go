@@ -1,19 +1,165 @@
 package parser
 
-import "kyra/internal/lexer"
+import (
+	"fmt"
+
+	"kyra/internal/diag"
+	"kyra/internal/lexer"
+)
 
 // Parser consumes tokens and produces an AST.
 type Parser struct {
-    tokens []lexer.Token
-    pos    int
+	tokens []lexer.Token
+	pos    int
 }
 
 func New(tokens []lexer.Token) *Parser {
-    return &Parser{tokens: tokens}
+	return &Parser{tokens: tokens}
+}
+
+// Parse consumes every token, expanding any macro declared along the way,
+// and returns the resulting module as an *AST.
+func (p *Parser) Parse() *AST {
+	table := newMacroTable()
+	var stmts []Stmt
+
+	for {
+		p.skipNewlines()
+		if p.peek().Type == lexer.EOF {
+			break
+		}
+
+		switch p.peek().Type {
+		case lexer.K_USE:
+			stmts = append(stmts, p.parseUse())
+		case lexer.K_MACRO:
+			table.define("", p.parseMacroDef())
+		default:
+			stmts = append(stmts, p.parseStmt())
+		}
+	}
+
+	expanded, diags := expandMacros(table, stmts)
+	if len(diags) > 0 {
+		panic(diags[0].Message)
+	}
+	return &AST{TopLevel: expanded}
+}
+
+// ParseExprOnly parses source as a single expression rather than a
+// module, for AsExpression callers (e.g. "x + 1 > limit"). The expression
+// is wrapped as a ReturnStmt so Run's result is the expression's value
+// rather than being discarded like an ordinary ExprStmt.
+func (p *Parser) ParseExprOnly() *AST {
+	p.skipNewlines()
+	expr := p.parseExpression()
+	p.skipNewlines()
+	if p.peek().Type != lexer.EOF {
+		panic(fmt.Sprintf("unexpected %s after expression", p.peek().Type))
+	}
+	return &AST{TopLevel: []Stmt{&ReturnStmt{Value: expr}}}
+}
+
+// ParseSafe runs Parse, recovering from the panics that syntax errors
+// currently raise (e.g. in parsePrefix, p.expect) and turning them into a
+// Diagnostic pointing at the token being parsed when the panic fired,
+// instead of crashing the process. A nil ast return means parsing failed;
+// callers should check len(diags) > 0 first.
+func (p *Parser) ParseSafe() (*AST, []diag.Diagnostic) {
+	return p.parseSafe(p.Parse)
+}
+
+// ParseExprOnlySafe mirrors ParseSafe for ParseExprOnly.
+func (p *Parser) ParseExprOnlySafe() (*AST, []diag.Diagnostic) {
+	return p.parseSafe(p.ParseExprOnly)
+}
+
+func (p *Parser) parseSafe(parse func() *AST) (ast *AST, diags []diag.Diagnostic) {
+	defer func() {
+		if r := recover(); r != nil {
+			diags = append(diags, diag.NewError(
+				fmt.Sprint(r),
+				p.currentSpan(),
+				"while parsing here",
+			))
+			ast = nil
+		}
+	}()
+
+	return parse(), nil
+}
+
+// currentSpan returns the Span of the token the parser is currently
+// positioned at, or a zero Span if there are no tokens left.
+func (p *Parser) currentSpan() diag.Span {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].Span
+	}
+	if len(p.tokens) > 0 {
+		return p.tokens[len(p.tokens)-1].Span
+	}
+	return diag.Span{}
+}
+
+// ---------------------------
+// Token cursor
+// ---------------------------
+
+// peek returns the token at the cursor without consuming it, or a
+// synthetic EOF token once the cursor runs past the end.
+func (p *Parser) peek() lexer.Token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return p.eofToken()
+}
+
+func (p *Parser) eofToken() lexer.Token {
+	if len(p.tokens) > 0 {
+		return lexer.Token{Type: lexer.EOF, Span: p.tokens[len(p.tokens)-1].Span}
+	}
+	return lexer.Token{Type: lexer.EOF}
+}
+
+// next consumes and returns the token at the cursor.
+func (p *Parser) next() lexer.Token {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return tok
+}
+
+// match consumes the token at the cursor if it has type t, reporting
+// whether it did.
+func (p *Parser) match(t lexer.TokenType) bool {
+	if p.peek().Type == t {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect consumes the token at the cursor, panicking with context if its
+// type isn't t; the panic is turned into a Diagnostic by parseSafe.
+func (p *Parser) expect(t lexer.TokenType, context string) lexer.Token {
+	tok := p.peek()
+	if tok.Type != t {
+		panic(fmt.Sprintf("expected %s (%s), got %s %q", t, context, tok.Type, tok.Lexeme))
+	}
+	return p.next()
+}
+
+// skipNewlines consumes any run of blank NEWLINE tokens at the cursor.
+func (p *Parser) skipNewlines() {
+	for p.peek().Type == lexer.NEWLINE {
+		p.next()
+	}
 }
 
-// Parse returns a placeholder AST object.
-// You will replace this with a real AST later.
-func (p *Parser) Parse() interface{} {
-    return nil
+// parseExpression is the entry point parseExpr's helpers (parseCall,
+// parseFString, parseMacroInvoke, ...) call to parse a nested
+// sub-expression at the lowest precedence.
+func (p *Parser) parseExpression() Expr {
+	return parseExpr(p, 0)
 }
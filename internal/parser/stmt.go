@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"kyra/internal/lexer"
+)
+
+// ---------------------------
+// Statement dispatch
+// ---------------------------
+
+// parseStmt parses one statement and consumes the NEWLINE(s) that
+// terminate it, so callers (parseBlock, parseMacroDef, Parse's top-level
+// loop) never have to skip NEWLINEs themselves between statements.
+func (p *Parser) parseStmt() Stmt {
+	p.skipNewlines()
+
+	var stmt Stmt
+	switch p.peek().Type {
+	case lexer.K_LET:
+		stmt = p.parseLetStmt()
+	case lexer.K_RETURN:
+		stmt = p.parseReturnStmt()
+	case lexer.K_EXIT:
+		p.next()
+		stmt = &ExitStmt{}
+	case lexer.K_PASS:
+		p.next()
+		stmt = &PassStmt{}
+	case lexer.K_IF:
+		stmt = p.parseIfStmt()
+	case lexer.K_WHILE:
+		stmt = p.parseWhileStmt()
+	case lexer.K_FOR:
+		stmt = p.parseForStmt()
+	case lexer.K_FUNC, lexer.K_DEF:
+		stmt = p.parseFuncDef()
+	default:
+		stmt = &ExprStmt{Expr: p.parseExpression()}
+	}
+
+	for p.match(lexer.NEWLINE) {
+	}
+	return stmt
+}
+
+// parseBlock parses the `: NEWLINE INDENT ... DEDENT` body that every
+// compound statement (if/while/for) uses, having already consumed
+// everything up to (not including) the ':'.
+func (p *Parser) parseBlock() []Stmt {
+	p.expect(lexer.COLON, "expected ':' to start block")
+	p.skipNewlines()
+	p.expect(lexer.INDENT, "expected indented block")
+
+	var body []Stmt
+	for p.peek().Type != lexer.DEDENT && p.peek().Type != lexer.EOF {
+		body = append(body, p.parseStmt())
+	}
+	p.expect(lexer.DEDENT, "expected dedent to close block")
+	return body
+}
+
+func (p *Parser) parseLetStmt() Stmt {
+	p.expect(lexer.K_LET, "let statement")
+	name := p.expect(lexer.IDENT, "let name").Lexeme
+	p.expect(lexer.ASSIGN, "expected '=' after let name")
+	return &LetStmt{Name: name, Expr: p.parseExpression()}
+}
+
+// parseReturnStmt allows a bare `return` (Value left nil) as well as
+// `return expr`.
+func (p *Parser) parseReturnStmt() Stmt {
+	p.expect(lexer.K_RETURN, "return statement")
+	switch p.peek().Type {
+	case lexer.NEWLINE, lexer.DEDENT, lexer.EOF:
+		return &ReturnStmt{}
+	default:
+		return &ReturnStmt{Value: p.parseExpression()}
+	}
+}
+
+func (p *Parser) parseIfStmt() Stmt {
+	p.expect(lexer.K_IF, "if statement")
+	cond := p.parseExpression()
+	then := p.parseBlock()
+
+	var elseBody []Stmt
+	p.skipNewlines()
+	if p.peek().Type == lexer.K_ELSE {
+		p.next()
+		if p.peek().Type == lexer.K_IF {
+			elseBody = []Stmt{p.parseIfStmt()}
+		} else {
+			elseBody = p.parseBlock()
+		}
+	}
+	return &IfStmt{Cond: cond, Then: then, Else: elseBody}
+}
+
+func (p *Parser) parseWhileStmt() Stmt {
+	p.expect(lexer.K_WHILE, "while statement")
+	cond := p.parseExpression()
+	return &WhileStmt{Cond: cond, Body: p.parseBlock()}
+}
+
+// parseForStmt parses Kyra's only loop form, `for i limit:`.
+func (p *Parser) parseForStmt() Stmt {
+	p.expect(lexer.K_FOR, "for statement")
+	varName := p.expect(lexer.IDENT, "loop variable").Lexeme
+	limit := p.parseExpression()
+	return &ForStmt{VarName: varName, Limit: limit, Body: p.parseBlock()}
+}
+
+// parseFuncDef parses `func name(params)` followed by one of three
+// bodies: `-> expr` (FuncExprDef), `: expr` on the same line
+// (FuncOneLiner), or `:` then an indented block (FuncDef).
+func (p *Parser) parseFuncDef() Stmt {
+	p.next() // K_FUNC or K_DEF
+	name := p.expect(lexer.IDENT, "function name").Lexeme
+	params := p.parseParams()
+
+	if p.match(lexer.ARROW) {
+		return &FuncExprDef{Name: name, Params: params, Expr: p.parseExpression()}
+	}
+
+	p.expect(lexer.COLON, "expected ':' or '->' after function parameters")
+	if p.peek().Type != lexer.NEWLINE {
+		return &FuncOneLiner{Name: name, Params: params, Expr: p.parseExpression()}
+	}
+
+	p.skipNewlines()
+	p.expect(lexer.INDENT, "expected indented function body")
+	var body []Stmt
+	for p.peek().Type != lexer.DEDENT && p.peek().Type != lexer.EOF {
+		body = append(body, p.parseStmt())
+	}
+	p.expect(lexer.DEDENT, "expected dedent to close function body")
+	return &FuncDef{Name: name, Params: params, Body: body}
+}
+
+func (p *Parser) parseParams() []Param {
+	p.expect(lexer.LPAREN, "expected '(' after function name")
+
+	var params []Param
+	if p.peek().Type != lexer.RPAREN {
+		for {
+			name := p.expect(lexer.IDENT, "parameter name").Lexeme
+			typ := ""
+			if p.match(lexer.COLON) {
+				typ = p.next().Lexeme
+			}
+			params = append(params, Param{Name: name, Type: typ})
+			if !p.match(lexer.COMMA) {
+				break
+			}
+		}
+	}
+
+	p.expect(lexer.RPAREN, "expected ')' after function parameters")
+	return params
+}
@@ -0,0 +1,157 @@
+// Package kyra embeds the Kyra language in Go host programs, the way
+// antonmedv/expr exposes its evaluator: compile a source once with
+// Compile, then Run it against different environments, or use Eval as a
+// one-shot convenience for scripts that don't need to be compiled ahead
+// of time.
+package kyra
+
+import (
+	"fmt"
+	"time"
+
+	"kyra/internal/bytecode"
+	"kyra/internal/diag"
+	"kyra/internal/kvm"
+	"kyra/internal/lexer"
+	"kyra/internal/optimize"
+	"kyra/internal/parser"
+)
+
+// Program is a compiled Kyra module or expression, ready to Run against
+// any number of environments.
+type Program struct {
+	bc       []byte
+	builtins map[string]func([]any) (any, error)
+	timeout  time.Duration
+	opBudget int
+}
+
+// config accumulates the Options passed to Compile.
+type config struct {
+	asExpression bool
+	builtins     map[string]func([]any) (any, error)
+	timeout      time.Duration
+	opBudget     int
+}
+
+// Option configures a Compile call.
+type Option func(*config)
+
+// AsExpression parses source as a single expression rather than a module,
+// for the common case of evaluating one value (e.g. "x + 1 > limit").
+func AsExpression() Option {
+	return func(c *config) { c.asExpression = true }
+}
+
+// WithBuiltins registers host-provided Go callables that Run binds on the
+// VM for OP_HOSTCALL. Each value must be a func([]any) (any, error);
+// anything else is dropped, so an OP_HOSTCALL naming it fails at run
+// time. The compiler never emits OP_HOSTCALL: Kyra source does not see
+// these names as identifiers and cannot call them.
+func WithBuiltins(builtins map[string]any) Option {
+	return func(c *config) {
+		for name, fn := range builtins {
+			if f, ok := fn.(func([]any) (any, error)); ok {
+				c.builtins[name] = f
+			}
+		}
+	}
+}
+
+// WithTimeout bounds wall-clock execution time; the VM loop in kvm.Run
+// checks it every 256 instructions and aborts with a timeout error once
+// exceeded.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) { c.timeout = d }
+}
+
+// WithOpBudget bounds the number of instructions the VM loop may execute,
+// a deterministic alternative (or complement) to WithTimeout for
+// sandboxing untrusted scripts.
+func WithOpBudget(n int) Option {
+	return func(c *config) { c.opBudget = n }
+}
+
+// Compile lexes, parses, and emits source into a Program.
+func Compile(source string, opts ...Option) (*Program, error) {
+	cfg := &config{builtins: map[string]func([]any) (any, error){}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	lx := lexer.New(source)
+	tokens := lx.Lex()
+	if errs := lx.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("kyra: lex error: %s", errs.Error())
+	}
+
+	p := parser.New(tokens)
+	var (
+		ast        *parser.AST
+		parseDiags []diag.Diagnostic
+	)
+	if cfg.asExpression {
+		ast, parseDiags = p.ParseExprOnlySafe()
+	} else {
+		ast, parseDiags = p.ParseSafe()
+	}
+	if len(parseDiags) > 0 {
+		return nil, fmt.Errorf("kyra: compile error: %s", parseDiags[0].Message)
+	}
+
+	chunk := bytecode.EmitChunk(ast)
+	optimize.Pass(chunk)
+	bc := bytecode.Encode(chunk)
+
+	return &Program{
+		bc:       bc,
+		builtins: cfg.builtins,
+		timeout:  cfg.timeout,
+		opBudget: cfg.opBudget,
+	}, nil
+}
+
+// Bytecode returns prog's compiled KBC bytes, for tooling (the kyrac CLI)
+// that wants to write or inspect them directly rather than running them.
+func (p *Program) Bytecode() []byte {
+	return p.bc
+}
+
+// Run executes prog against env, binding each env entry as a host
+// builtin if it's a Go callable. Entries that aren't Go callables are
+// ignored: they are not passed to the VM as globals.
+func Run(prog *Program, env map[string]any) (any, error) {
+	vm := kvm.New(prog.bc)
+
+	for name, fn := range prog.builtins {
+		vm.Bind(name, fn)
+	}
+	for name, value := range env {
+		if fn, ok := value.(func([]any) (any, error)); ok {
+			vm.Bind(name, fn)
+		}
+	}
+
+	if prog.timeout > 0 {
+		vm.SetDeadline(time.Now().Add(prog.timeout))
+	}
+	if prog.opBudget > 0 {
+		vm.SetOpBudget(prog.opBudget)
+	}
+
+	result, diags := vm.RunSafe()
+	if len(diags) > 0 {
+		return nil, fmt.Errorf("kyra: runtime error: %s", diags[0].Message)
+	}
+	return result, nil
+}
+
+// Eval compiles and runs source in one step, for callers that don't need
+// to reuse a compiled Program across calls.
+func Eval(source string, env map[string]any) (any, error) {
+	prog, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return Run(prog, env)
+}